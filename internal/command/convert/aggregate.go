@@ -0,0 +1,415 @@
+package convert
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/karupanerura/dutil/internal/command"
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+type AggregateCommand struct {
+	GroupBy    []string `name:"group-by" short:"g" optional:"" help:"Comma separated property paths to group entities by. Use '.' to refer embedded entity properties, and an entity with an array value belongs to the group of each element (e.g. --group-by=status,owner.name)"`
+	Count      []string `name:"count" optional:"" sep:"none" placeholder:"ALIAS" group:"Aggregation" help:"Count entities of each group, the value is alias name of the result (default: count). Repeatable. This is the default if no aggregation is specified."`
+	Sum        []string `name:"sum" optional:"" sep:"none" placeholder:"PATH[=ALIAS]" group:"Aggregation" help:"Sum numeric values of the property path (default alias: sum_<path>). Repeatable."`
+	Average    []string `name:"avg" optional:"" sep:"none" placeholder:"PATH[=ALIAS]" group:"Aggregation" help:"Average numeric values of the property path (default alias: avg_<path>). Repeatable."`
+	Min        []string `name:"min" optional:"" sep:"none" placeholder:"PATH[=ALIAS]" group:"Aggregation" help:"Minimum value of the property path in Datastore value ordering (default alias: min_<path>). Repeatable."`
+	Max        []string `name:"max" optional:"" sep:"none" placeholder:"PATH[=ALIAS]" group:"Aggregation" help:"Maximum value of the property path in Datastore value ordering (default alias: max_<path>). Repeatable."`
+	Percentile []string `name:"percentile" optional:"" sep:"none" placeholder:"P:PATH[=ALIAS]" group:"Aggregation" help:"Nearest-rank P-th percentile of numeric values of the property path (default alias: p<P>_<path>). Repeatable. (e.g. --percentile=95:latency)"`
+}
+
+func (r *AggregateCommand) Run(ctx context.Context, opts command.GlobalOptions) error {
+	specs, err := r.aggregationSpecs()
+	if err != nil {
+		return err
+	}
+
+	groups := map[string]*aggregationGroup{}
+	var keys []string
+	reader := &jsonReader[*datastore.Entity]{decoder: json.NewDecoder(opts.Stdin)}
+	for entity, err := range reader.Iter() {
+		if err != nil {
+			return err
+		}
+		if entity == nil {
+			continue
+		}
+
+		props := entityProperties(entity)
+		seen := map[string]struct{}{}
+		for _, values := range groupValues(props, r.GroupBy) {
+			b, err := json.Marshal(values)
+			if err != nil {
+				return err
+			}
+
+			// an entity belongs to a group at most once even if an array has duplicate elements
+			key := string(b)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+
+			group, ok := groups[key]
+			if !ok {
+				group = newAggregationGroup(values, specs)
+				groups[key] = group
+				keys = append(keys, key)
+			}
+			group.add(props)
+		}
+	}
+
+	sorted := make([]*aggregationGroup, len(keys))
+	for i, key := range keys {
+		sorted[i] = groups[key]
+	}
+	slices.SortStableFunc(sorted, func(a, b *aggregationGroup) int {
+		for i := range a.values {
+			if c := compareValues(a.values[i], b.values[i]); c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+
+	encoder := json.NewEncoder(opts.Stdout)
+	for _, group := range sorted {
+		if err := encoder.Encode(group.toEntity(r.GroupBy)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aggregationSpec is an aggregate function with the target property path.
+type aggregationSpec struct {
+	function   string // count, sum, avg, min, max or percentile
+	path       []string
+	percentile float64
+	alias      string
+}
+
+func (r *AggregateCommand) aggregationSpecs() ([]aggregationSpec, error) {
+	var specs []aggregationSpec
+	for _, alias := range r.Count {
+		if alias == "" {
+			alias = "count"
+		}
+		specs = append(specs, aggregationSpec{function: "count", alias: alias})
+	}
+	for _, function := range []struct {
+		name   string
+		values []string
+	}{
+		{name: "sum", values: r.Sum},
+		{name: "avg", values: r.Average},
+		{name: "min", values: r.Min},
+		{name: "max", values: r.Max},
+	} {
+		for _, value := range function.values {
+			path, alias, _ := strings.Cut(value, "=")
+			if path == "" {
+				return nil, fmt.Errorf("--%s requires a property path", function.name)
+			}
+			if alias == "" {
+				alias = function.name + "_" + path
+			}
+			specs = append(specs, aggregationSpec{function: function.name, path: strings.Split(path, "."), alias: alias})
+		}
+	}
+	for _, value := range r.Percentile {
+		p, pathAndAlias, ok := strings.Cut(value, ":")
+		if !ok {
+			return nil, fmt.Errorf("--percentile must be P:PATH[=ALIAS]: %s", value)
+		}
+		percentile, err := strconv.ParseFloat(p, 64)
+		if err != nil || percentile <= 0 || percentile > 100 {
+			return nil, fmt.Errorf("percentile must be in (0, 100]: %s", p)
+		}
+		path, alias, _ := strings.Cut(pathAndAlias, "=")
+		if path == "" {
+			return nil, fmt.Errorf("--percentile requires a property path")
+		}
+		if alias == "" {
+			alias = "p" + p + "_" + path
+		}
+		specs = append(specs, aggregationSpec{function: "percentile", path: strings.Split(path, "."), percentile: percentile, alias: alias})
+	}
+	if len(specs) == 0 {
+		specs = append(specs, aggregationSpec{function: "count", alias: "count"})
+	}
+
+	names := make(map[string]struct{}, len(r.GroupBy)+len(specs))
+	for _, name := range r.GroupBy {
+		names[name] = struct{}{}
+	}
+	for _, spec := range specs {
+		if _, ok := names[spec.alias]; ok {
+			return nil, fmt.Errorf("duplicate property name in the results: %s", spec.alias)
+		}
+		names[spec.alias] = struct{}{}
+	}
+	return specs, nil
+}
+
+// entityProperties returns the properties with the entity key as __key__ property to be referred by paths.
+func entityProperties(entity *datastore.Entity) []datastore.Property {
+	if entity.Key == nil {
+		return entity.Properties
+	}
+	return append(slices.Clip(entity.Properties), datastore.Property{
+		Name:  "__key__",
+		Value: datastore.Value{Type: datastore.KeyType, Value: entity.Key},
+	})
+}
+
+// resolvePath returns the values of the property path. Array values are expanded to the elements.
+func resolvePath(props []datastore.Property, path []string) []datastore.Value {
+	var values []datastore.Value
+	for _, prop := range props {
+		if prop.Name == path[0] {
+			values = append(values, expandValue(prop.Value, path[1:])...)
+		}
+	}
+	return values
+}
+
+func expandValue(v datastore.Value, rest []string) []datastore.Value {
+	if v.Type == datastore.ArrayType {
+		var values []datastore.Value
+		for _, elem := range v.Value.([]datastore.Value) {
+			values = append(values, expandValue(elem, rest)...)
+		}
+		return values
+	}
+	if len(rest) == 0 {
+		return []datastore.Value{v}
+	}
+	if v.Type != datastore.EntityType {
+		return nil
+	}
+
+	switch value := v.Value.(type) {
+	case []datastore.Property:
+		return resolvePath(value, rest)
+	case datastore.EmbeddedEntity:
+		props := value.Properties
+		if value.Key != nil {
+			props = append(slices.Clip(props), datastore.Property{
+				Name:  "__key__",
+				Value: datastore.Value{Type: datastore.KeyType, Value: value.Key},
+			})
+		}
+		return resolvePath(props, rest)
+	default:
+		panic(fmt.Sprintf("unexpected entity value type: %T", v.Value))
+	}
+}
+
+// groupValues returns the combinations of the group-by values the entity belongs to.
+// A missing property is grouped as null.
+func groupValues(props []datastore.Property, groupBy []string) [][]datastore.Value {
+	combinations := [][]datastore.Value{{}}
+	for _, path := range groupBy {
+		values := resolvePath(props, strings.Split(path, "."))
+		if len(values) == 0 {
+			values = []datastore.Value{{Type: datastore.NullType}}
+		}
+
+		next := make([][]datastore.Value, 0, len(combinations)*len(values))
+		for _, combination := range combinations {
+			for _, value := range values {
+				next = append(next, append(slices.Clip(combination), value))
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+type aggregationGroup struct {
+	values      []datastore.Value
+	aggregators []aggregator
+}
+
+func newAggregationGroup(values []datastore.Value, specs []aggregationSpec) *aggregationGroup {
+	group := &aggregationGroup{values: values, aggregators: make([]aggregator, len(specs))}
+	for i, spec := range specs {
+		group.aggregators[i] = aggregator{spec: spec}
+	}
+	return group
+}
+
+func (g *aggregationGroup) add(props []datastore.Property) {
+	for i := range g.aggregators {
+		g.aggregators[i].add(props)
+	}
+}
+
+func (g *aggregationGroup) toEntity(groupBy []string) *datastore.Entity {
+	entity := &datastore.Entity{Properties: make([]datastore.Property, 0, len(groupBy)+len(g.aggregators))}
+	for i, path := range groupBy {
+		entity.Properties = append(entity.Properties, datastore.Property{Name: path, Value: g.values[i]})
+	}
+	for _, a := range g.aggregators {
+		entity.Properties = append(entity.Properties, datastore.Property{Name: a.spec.alias, Value: a.result()})
+	}
+	return entity
+}
+
+// aggregator accumulates the values of the property path in a group.
+type aggregator struct {
+	spec   aggregationSpec
+	count  int64
+	values []datastore.Value
+}
+
+func (a *aggregator) add(props []datastore.Property) {
+	if a.spec.function == "count" {
+		a.count++
+		return
+	}
+
+	for _, v := range resolvePath(props, a.spec.path) {
+		switch a.spec.function {
+		case "sum", "avg", "percentile":
+			if v.Type != datastore.IntType && v.Type != datastore.FloatType {
+				continue
+			}
+		case "min", "max":
+			if v.Type == datastore.NullType {
+				continue
+			}
+		}
+		a.values = append(a.values, v)
+	}
+}
+
+func (a *aggregator) result() datastore.Value {
+	switch a.spec.function {
+	case "count":
+		return datastore.Value{Type: datastore.IntType, Value: a.count}
+
+	case "sum":
+		return sumValues(a.values)
+
+	case "avg":
+		if len(a.values) == 0 {
+			return datastore.Value{Type: datastore.NullType}
+		}
+		var sum float64
+		for _, v := range a.values {
+			sum += toFloat(v)
+		}
+		return datastore.Value{Type: datastore.FloatType, Value: sum / float64(len(a.values))}
+
+	case "min", "max":
+		if len(a.values) == 0 {
+			return datastore.Value{Type: datastore.NullType}
+		}
+		if a.spec.function == "min" {
+			return slices.MinFunc(a.values, compareValues)
+		}
+		return slices.MaxFunc(a.values, compareValues)
+
+	case "percentile":
+		if len(a.values) == 0 {
+			return datastore.Value{Type: datastore.NullType}
+		}
+		values := slices.Clone(a.values)
+		slices.SortFunc(values, compareValues)
+		rank := int(math.Ceil(a.spec.percentile / 100 * float64(len(values))))
+		return values[max(rank, 1)-1]
+
+	default:
+		panic("unknown aggregate function: " + a.spec.function)
+	}
+}
+
+// sumValues sums the numeric values. The result is an integer if all values are integers like Datastore.
+func sumValues(values []datastore.Value) datastore.Value {
+	var intSum int64
+	var floatSum float64
+	isFloat := false
+	for _, v := range values {
+		if v.Type == datastore.FloatType {
+			isFloat = true
+		} else {
+			intSum += v.Value.(int64)
+		}
+		floatSum += toFloat(v)
+	}
+	if isFloat {
+		return datastore.Value{Type: datastore.FloatType, Value: floatSum}
+	}
+	return datastore.Value{Type: datastore.IntType, Value: intSum}
+}
+
+func toFloat(v datastore.Value) float64 {
+	if v.Type == datastore.IntType {
+		return float64(v.Value.(int64))
+	}
+	return v.Value.(float64)
+}
+
+// valueTypeOrders is the order of value types in Datastore. Integers and floats are compared as numbers.
+var valueTypeOrders = map[datastore.Type]int{
+	datastore.NullType:      0,
+	datastore.IntType:       1,
+	datastore.FloatType:     1,
+	datastore.TimestampType: 2,
+	datastore.BoolType:      3,
+	datastore.StringType:    4,
+	datastore.BlobType:      5,
+	datastore.KeyType:       6,
+	datastore.GeoPointType:  7,
+	datastore.ArrayType:     8,
+	datastore.EntityType:    9,
+}
+
+// compareValues compares the values in Datastore value ordering. Arrays and entities of the same type are equal.
+func compareValues(a, b datastore.Value) int {
+	if c := cmp.Compare(valueTypeOrders[a.Type], valueTypeOrders[b.Type]); c != 0 {
+		return c
+	}
+
+	switch a.Type {
+	case datastore.IntType, datastore.FloatType:
+		if a.Type == datastore.IntType && b.Type == datastore.IntType {
+			return cmp.Compare(a.Value.(int64), b.Value.(int64))
+		}
+		return cmp.Compare(toFloat(a), toFloat(b))
+	case datastore.TimestampType:
+		return a.Value.(time.Time).Compare(b.Value.(time.Time))
+	case datastore.BoolType:
+		av, bv := a.Value.(bool), b.Value.(bool)
+		if av == bv {
+			return 0
+		} else if !av {
+			return -1
+		}
+		return 1
+	case datastore.StringType:
+		return strings.Compare(a.Value.(string), b.Value.(string))
+	case datastore.BlobType:
+		return strings.Compare(string(a.Value.([]byte)), string(b.Value.([]byte)))
+	case datastore.KeyType:
+		return a.Value.(*datastore.Key).Compare(b.Value.(*datastore.Key))
+	case datastore.GeoPointType:
+		av, bv := a.Value.(datastore.GeoPoint), b.Value.(datastore.GeoPoint)
+		if c := cmp.Compare(av.Lat, bv.Lat); c != 0 {
+			return c
+		}
+		return cmp.Compare(av.Lng, bv.Lng)
+	default:
+		return 0
+	}
+}
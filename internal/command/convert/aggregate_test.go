@@ -0,0 +1,92 @@
+package convert_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/karupanerura/dutil/internal/command"
+	"github.com/karupanerura/dutil/internal/command/convert"
+)
+
+func TestAggregateCommand_Run(t *testing.T) {
+	t.Parallel()
+
+	stdin := strings.Join([]string{
+		`{"key":{"kind":"Task","id":1},"properties":[{"name":"status","type":"string","value":"done"},{"name":"cost","type":"int","value":3},{"name":"tags","type":"array","value":[{"type":"string","value":"a"},{"type":"string","value":"b"},{"type":"string","value":"a"}]},{"name":"owner","type":"entity","value":[{"name":"name","type":"string","value":"alice"}]}]}`,
+		`{"key":{"kind":"Task","id":2},"properties":[{"name":"status","type":"string","value":"todo"},{"name":"cost","type":"float","value":1.5},{"name":"tags","type":"array","value":[{"type":"string","value":"b"}]}]}`,
+		`{"key":{"kind":"Task","id":3},"properties":[{"name":"status","type":"string","value":"done"},{"name":"cost","type":"int","value":5},{"name":"owner","type":"entity","value":[{"name":"name","type":"string","value":"bob"}]}]}`,
+		`null`,
+	}, "\n")
+
+	tests := []struct {
+		name    string
+		cmd     *convert.AggregateCommand
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "count by default",
+			cmd:  &convert.AggregateCommand{},
+			want: []string{
+				`{"key":null,"properties":[{"type":"int","value":3,"name":"count"}]}`,
+			},
+		},
+		{
+			name: "functions",
+			cmd: &convert.AggregateCommand{
+				GroupBy:    []string{"status"},
+				Sum:        []string{"cost"},
+				Average:    []string{"cost=average"},
+				Min:        []string{"owner.name"},
+				Max:        []string{"__key__"},
+				Percentile: []string{"50:cost"},
+			},
+			want: []string{
+				`{"key":null,"properties":[{"type":"string","value":"done","name":"status"},{"type":"int","value":8,"name":"sum_cost"},{"type":"float","value":4,"name":"average"},{"type":"string","value":"alice","name":"min_owner.name"},{"type":"key","value":{"kind":"Task","id":3},"name":"max___key__"},{"type":"int","value":3,"name":"p50_cost"}]}`,
+				`{"key":null,"properties":[{"type":"string","value":"todo","name":"status"},{"type":"float","value":1.5,"name":"sum_cost"},{"type":"float","value":1.5,"name":"average"},{"type":"null","value":null,"name":"min_owner.name"},{"type":"key","value":{"kind":"Task","id":2},"name":"max___key__"},{"type":"float","value":1.5,"name":"p50_cost"}]}`,
+			},
+		},
+		{
+			name: "array and embedded entity",
+			cmd:  &convert.AggregateCommand{GroupBy: []string{"tags", "owner.name"}, Count: []string{"n"}},
+			want: []string{
+				`{"key":null,"properties":[{"type":"null","value":null,"name":"tags"},{"type":"string","value":"bob","name":"owner.name"},{"type":"int","value":1,"name":"n"}]}`,
+				`{"key":null,"properties":[{"type":"string","value":"a","name":"tags"},{"type":"string","value":"alice","name":"owner.name"},{"type":"int","value":1,"name":"n"}]}`,
+				`{"key":null,"properties":[{"type":"string","value":"b","name":"tags"},{"type":"null","value":null,"name":"owner.name"},{"type":"int","value":1,"name":"n"}]}`,
+				`{"key":null,"properties":[{"type":"string","value":"b","name":"tags"},{"type":"string","value":"alice","name":"owner.name"},{"type":"int","value":1,"name":"n"}]}`,
+			},
+		},
+		{
+			name:    "duplicate name",
+			cmd:     &convert.AggregateCommand{GroupBy: []string{"status"}, Count: []string{"status"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid percentile",
+			cmd:     &convert.AggregateCommand{Percentile: []string{"101:cost"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			stdout := strings.Builder{}
+			err := tt.cmd.Run(t.Context(), command.GlobalOptions{Stdin: strings.NewReader(stdin), Stdout: &stdout})
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			got := strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n")
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected results (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
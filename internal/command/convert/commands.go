@@ -1,6 +1,7 @@
 package convert
 
 type Commands struct {
-	Table TableCommand `cmd:""`
-	Key   KeyCommand   `cmd:""`
+	Table     TableCommand     `cmd:""`
+	Key       KeyCommand       `cmd:""`
+	Aggregate AggregateCommand `cmd:""`
 }
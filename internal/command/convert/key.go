@@ -4,9 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
-	"fmt"
 	"io"
-	"strings"
 
 	"github.com/karupanerura/dutil/internal/command"
 	"github.com/karupanerura/dutil/internal/datastore"
@@ -20,7 +18,7 @@ type KeyCommand struct {
 }
 
 func (r *KeyCommand) Run(ctx context.Context, opts command.GlobalOptions) error {
-	reader, err := newKeyReader(r.From, opts.Stdin)
+	reader, err := parser.NewKeyReader(r.From, opts.Stdin, &parser.KeyParser{})
 	if err != nil {
 		return err
 	}
@@ -45,96 +43,6 @@ func (r *KeyCommand) Run(ctx context.Context, opts command.GlobalOptions) error
 	}
 }
 
-type keyReader interface {
-	Read() (*datastore.Key, error)
-}
-
-func newKeyReader(format string, reader io.Reader) (keyReader, error) {
-	switch format {
-	case "json":
-		return &jsonKeyReader{decoder: json.NewDecoder(reader)}, nil
-	case "gql":
-		return &gqlKeyReader{reader: bufio.NewReader(reader), keyParser: &parser.KeyParser{}}, nil
-	case "encoded":
-		return &encodedKeyReader{reader: bufio.NewReader(reader)}, nil
-	case "proto":
-		return &protoKeyReader{reader: bufio.NewReader(reader)}, nil
-	case "auto":
-		format, reader, err := detectFormat(reader)
-		if err != nil {
-			return nil, fmt.Errorf("detect key format: %w", err)
-		}
-		return newKeyReader(format, reader)
-	default:
-		panic("unknown format:" + format)
-	}
-}
-
-func detectFormat(reader io.Reader) (string, io.Reader, error) {
-	var buffer [4]byte
-	if _, err := io.ReadFull(reader, buffer[:]); err != nil {
-		return "", nil, err
-	}
-
-	header := string(buffer[:])
-	if header[0] == '{' {
-		return "json", io.MultiReader(strings.NewReader(header), reader), nil
-	}
-	if header[3] == '(' {
-		return "gql", io.MultiReader(strings.NewReader(header), reader), nil
-	}
-	if header[0] == 'p' && header[1] == 'a' && ((header[2] == 'r' && header[3] == 't') || (header[2] == 't' && header[3] == 'h')) {
-		return "proto", io.MultiReader(strings.NewReader(header), reader), nil
-	}
-	return "encoded", io.MultiReader(strings.NewReader(header), reader), nil
-}
-
-type jsonKeyReader struct {
-	decoder *json.Decoder
-}
-
-func (r *jsonKeyReader) Read() (key *datastore.Key, err error) {
-	err = r.decoder.Decode(&key)
-	return
-}
-
-type gqlKeyReader struct {
-	reader    *bufio.Reader
-	keyParser *parser.KeyParser
-}
-
-func (r *gqlKeyReader) Read() (*datastore.Key, error) {
-	line, _, err := r.reader.ReadLine()
-	if err != nil {
-		return nil, err
-	}
-	return r.keyParser.ParseKey(string(line))
-}
-
-type encodedKeyReader struct {
-	reader *bufio.Reader
-}
-
-func (r *encodedKeyReader) Read() (*datastore.Key, error) {
-	line, _, err := r.reader.ReadLine()
-	if err != nil {
-		return nil, err
-	}
-	return datastore.DecodeKey(string(line))
-}
-
-type protoKeyReader struct {
-	reader *bufio.Reader
-}
-
-func (r *protoKeyReader) Read() (*datastore.Key, error) {
-	line, _, err := r.reader.ReadLine()
-	if err != nil {
-		return nil, err
-	}
-	return datastore.ParseEncodedProtoKey(string(line))
-}
-
 type keyWriter interface {
 	Write(*datastore.Key) error
 	Flush() error
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"iter"
+	"maps"
 	"slices"
 	"strconv"
 	"time"
@@ -300,26 +301,36 @@ func explainToTableEntryReader(decoder *json.Decoder) iter.Seq2[tableEntry, erro
 			}
 
 			var entry tableEntry
-			for i, indexUsed := range metrics.PlanSummary.IndexesUsed {
-				prefix := "IndexesUsed[" + strconv.Itoa(i) + "]."
-				if indexUsed != nil {
-					for k, v := range *indexUsed {
-						entry.Header = append(entry.Header, prefix+k)
-						entry.Row = append(entry.Row, fmt.Sprint(v))
+			if metrics.PlanSummary != nil {
+				for i, indexUsed := range metrics.PlanSummary.IndexesUsed {
+					prefix := "IndexesUsed[" + strconv.Itoa(i) + "]."
+					if indexUsed != nil {
+						for _, k := range slices.Sorted(maps.Keys(*indexUsed)) {
+							entry.Header = append(entry.Header, prefix+k)
+							entry.Row = append(entry.Row, fmt.Sprint((*indexUsed)[k]))
+						}
 					}
 				}
 			}
-			entry.Header = append(entry.Header, "ResultsReturned", "ExecutionDuration", "ReadOperations")
-			entry.Row = append(entry.Row, strconv.Itoa(int(metrics.ExecutionStats.ResultsReturned)), metrics.ExecutionStats.ExecutionDuration.String(), strconv.Itoa(int(metrics.ExecutionStats.ReadOperations)))
-			if metrics.ExecutionStats.DebugStats != nil {
-				b, err := json.Marshal(metrics.ExecutionStats.DebugStats)
-				if err != nil {
-					yield(tableEntry{}, err)
-					return
+
+			// execution stats are present only if the query was executed (--explain=analyze)
+			if stats := metrics.ExecutionStats; stats != nil {
+				var executionDuration string
+				if stats.ExecutionDuration != nil {
+					executionDuration = stats.ExecutionDuration.String()
 				}
+				entry.Header = append(entry.Header, "ResultsReturned", "ExecutionDuration", "ReadOperations")
+				entry.Row = append(entry.Row, strconv.Itoa(int(stats.ResultsReturned)), executionDuration, strconv.Itoa(int(stats.ReadOperations)))
+				if stats.DebugStats != nil {
+					b, err := json.Marshal(stats.DebugStats)
+					if err != nil {
+						yield(tableEntry{}, err)
+						return
+					}
 
-				entry.Header = append(entry.Header, "DebugStats")
-				entry.Row = append(entry.Row, string(b))
+					entry.Header = append(entry.Header, "DebugStats")
+					entry.Row = append(entry.Row, string(b))
+				}
 			}
 			if !yield(entry, nil) {
 				break
@@ -116,4 +116,33 @@ func TestTableCommand_Run(t *testing.T) {
 			t.Errorf("expected table convert from keyed embedded entity: %s", df)
 		}
 	})
+
+	t.Run("FromExplain", func(t *testing.T) {
+		t.Parallel()
+
+		stdin := strings.NewReader(strings.Join([]string{
+			`{"PlanSummary":{"IndexesUsed":[{"query_scope":"Collection group","properties":"(status ASC, __name__ ASC)"}]}}`,
+			`{"PlanSummary":{"IndexesUsed":[{"query_scope":"Collection group","properties":"(status ASC, __name__ ASC)"}]},"ExecutionStats":{"ResultsReturned":1,"ExecutionDuration":1500000,"ReadOperations":2,"DebugStats":{"documents_scanned":"1"}}}`,
+		}, "\n"))
+		stdout := strings.Builder{}
+		cmd := &convert.TableCommand{From: "explain"}
+		if err := cmd.Run(t.Context(), command.GlobalOptions{Stdin: stdin, Stdout: &stdout}); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := `+----------------------------+----------------------------+
+| IndexesUsed[0].properties  | IndexesUsed[0].query_scope |
++----------------------------+----------------------------+
+| (status ASC, __name__ ASC) | Collection group           |
++----------------------------+----------------------------+
++----------------------------+----------------------------+-----------------+-------------------+----------------+---------------------------+
+| IndexesUsed[0].properties  | IndexesUsed[0].query_scope | ResultsReturned | ExecutionDuration | ReadOperations | DebugStats                |
++----------------------------+----------------------------+-----------------+-------------------+----------------+---------------------------+
+| (status ASC, __name__ ASC) | Collection group           |               1 | 1.5ms             |              2 | {"documents_scanned":"1"} |
++----------------------------+----------------------------+-----------------+-------------------+----------------+---------------------------+
+`
+		if df := cmp.Diff(expected, stdout.String()); df != "" {
+			t.Errorf("expected table convert from plan only and analyzed explain: %s", df)
+		}
+	})
 }
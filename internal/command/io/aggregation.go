@@ -0,0 +1,103 @@
+package io
+
+import (
+	"fmt"
+	"strconv"
+
+	"cloud.google.com/go/datastore/apiv1/datastorepb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+// aggregation is an aggregation of an aggregation query.
+type aggregation struct {
+	operator string // count, count_up_to, sum or avg
+	property string
+	upTo     int64
+	alias    string
+}
+
+// newAggregations creates aggregations from --count, --count-up-to, --sum and --avg options.
+// It fails if some aggregations have the same alias.
+// An empty alias of count is named count_<kind> like the SDK (count for kindless queries), and the other empty aliases are named by Datastore.
+func newAggregations(kind string, counts []string, countUpTos, sums, avgs []FieldAndAlias) ([]aggregation, error) {
+	var aggregations []aggregation
+	for _, alias := range counts {
+		if alias == "" && kind != "" {
+			alias = "count_" + kind
+		} else if alias == "" {
+			alias = "count"
+		}
+		aggregations = append(aggregations, aggregation{operator: "count", alias: alias})
+	}
+	for _, countUpTo := range countUpTos {
+		upTo, err := strconv.ParseInt(countUpTo.Field, 10, 64)
+		if err != nil || upTo <= 0 {
+			return nil, fmt.Errorf("--count-up-to must be a positive integer: %s", countUpTo.Field)
+		}
+		aggregations = append(aggregations, aggregation{operator: "count_up_to", upTo: upTo, alias: countUpTo.Alias})
+	}
+	for _, sum := range sums {
+		aggregations = append(aggregations, aggregation{operator: "sum", property: sum.Field, alias: sum.Alias})
+	}
+	for _, avg := range avgs {
+		aggregations = append(aggregations, aggregation{operator: "avg", property: avg.Field, alias: avg.Alias})
+	}
+
+	aliases := make(map[string]struct{}, len(aggregations))
+	for _, a := range aggregations {
+		if a.alias == "" {
+			continue
+		}
+		if _, ok := aliases[a.alias]; ok {
+			return nil, fmt.Errorf("duplicate aggregation alias: %s", a.alias)
+		}
+		aliases[a.alias] = struct{}{}
+	}
+	return aggregations, nil
+}
+
+// newAggregationQuery creates the aggregation query of the SDK. All the aggregations must be supported by the SDK.
+func newAggregationQuery(query *datastore.Query, aggregations []aggregation) *datastore.AggregationQuery {
+	aq := query.NewAggregationQuery()
+	for _, a := range aggregations {
+		aq = a.apply(aq)
+	}
+	return aq
+}
+
+// supportedBySDK reports whether the SDK supports the aggregation. Otherwise, use the low-level client.
+func (a aggregation) supportedBySDK() bool {
+	return a.operator != "count_up_to"
+}
+
+func (a aggregation) apply(aq *datastore.AggregationQuery) *datastore.AggregationQuery {
+	switch a.operator {
+	case "count":
+		return aq.WithCount(a.alias)
+	case "sum":
+		return aq.WithSum(a.property, a.alias)
+	case "avg":
+		return aq.WithAvg(a.property, a.alias)
+	default:
+		panic("unsupported aggregation by the SDK: " + a.operator)
+	}
+}
+
+func (a aggregation) toProto() *datastorepb.AggregationQuery_Aggregation {
+	dest := &datastorepb.AggregationQuery_Aggregation{Alias: a.alias}
+	switch a.operator {
+	case "count":
+		dest.Operator = &datastorepb.AggregationQuery_Aggregation_Count_{Count: &datastorepb.AggregationQuery_Aggregation_Count{}}
+	case "count_up_to":
+		dest.Operator = &datastorepb.AggregationQuery_Aggregation_Count_{Count: &datastorepb.AggregationQuery_Aggregation_Count{UpTo: wrapperspb.Int64(a.upTo)}}
+	case "sum":
+		dest.Operator = &datastorepb.AggregationQuery_Aggregation_Sum_{Sum: &datastorepb.AggregationQuery_Aggregation_Sum{Property: &datastorepb.PropertyReference{Name: a.property}}}
+	case "avg":
+		dest.Operator = &datastorepb.AggregationQuery_Aggregation_Avg_{Avg: &datastorepb.AggregationQuery_Aggregation_Avg{Property: &datastorepb.PropertyReference{Name: a.property}}}
+	default:
+		panic("unknown aggregation: " + a.operator)
+	}
+	return dest
+}
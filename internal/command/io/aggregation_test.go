@@ -0,0 +1,70 @@
+package io
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewAggregations(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		counts     []string
+		countUpTos []FieldAndAlias
+		sums       []FieldAndAlias
+		avgs       []FieldAndAlias
+		want       []aggregation
+		wantErr    bool
+	}{
+		{
+			name:       "multiple aggregations",
+			counts:     []string{""},
+			countUpTos: []FieldAndAlias{{Field: "100", Alias: "atMost"}},
+			sums:       []FieldAndAlias{{Field: "a"}, {Field: "b", Alias: "totalB"}},
+			avgs:       []FieldAndAlias{{Field: "a"}},
+			want: []aggregation{
+				{operator: "count", alias: "count_Task"},
+				{operator: "count_up_to", upTo: 100, alias: "atMost"},
+				{operator: "sum", property: "a"},
+				{operator: "sum", property: "b", alias: "totalB"},
+				{operator: "avg", property: "a"},
+			},
+		},
+		{
+			name:    "duplicate alias",
+			sums:    []FieldAndAlias{{Field: "a", Alias: "x"}},
+			avgs:    []FieldAndAlias{{Field: "b", Alias: "x"}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate default count alias",
+			counts:  []string{"", "count_Task"},
+			wantErr: true,
+		},
+		{
+			name:       "invalid count up to",
+			countUpTos: []FieldAndAlias{{Field: "0"}},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := newAggregations("Task", tt.counts, tt.countUpTos, tt.sums, tt.avgs)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(aggregation{})); diff != "" {
+				t.Errorf("unexpected aggregations (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,474 @@
+package io
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"iter"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+type BatchOptions struct {
+	// BatchSize is the maximum number of mutations committed in a transaction
+	BatchSize int `name:"batch-size" optional:"" group:"Batch" help:"Number of mutations per commit. When specified, the input is streamed and mutations are split into multiple transactions (default: all mutations in a single transaction)"`
+
+	// Parallelism is the number of workers committing batches concurrently
+	Parallelism int `name:"parallelism" optional:"" default:"1" group:"Batch" help:"Number of workers committing batches concurrently (requires --batch-size). Mutations for the same key are always committed by the same worker in input order"`
+
+	// Checkpoint is a file path to record committed batches for resuming
+	Checkpoint string `name:"checkpoint" type:"path" optional:"" group:"Batch" help:"File to record committed batches (requires --batch-size). Run again with the same file and the same input to skip the already committed batches. It cannot be used to insert entities with incomplete keys"`
+
+	// ExpectCount is the declared number of mutations in the input for confirmation in streaming mode
+	ExpectCount int `name:"expect-count" optional:"" group:"Batch" help:"Declared number of entities in the input. Used for the confirmation of --batch-size instead of pre-scanning the input. If the input does not match it, the command fails when the mismatch is found, and the batches committed before are reported but not rolled back"`
+}
+
+type mutationBatch struct {
+	index     int
+	partition int
+	keys      datastore.Keys
+	entities  []*datastore.Entity
+	patches   []*datastore.EntityPatch
+	mutations []*datastore.Mutation
+
+	// fingerprint is the hash of the keys read from the input to record in the checkpoint
+	fingerprint string
+}
+
+func (b *mutationBatch) add(entry mutationEntry) {
+	b.keys = append(b.keys, entry.key)
+	b.entities = append(b.entities, entry.entity)
+	b.patches = append(b.patches, entry.patch)
+	b.mutations = append(b.mutations, entry.mutation)
+}
+
+// readBatches reads mutations from the source and groups them into batches.
+// Mutations are distributed to the partitions by the hash of their keys, so
+// that mutations for the same key always belong to the same partition in input order.
+// Incomplete keys never refer to the same entity, so they are distributed round-robin instead.
+// If expectCount is positive, it fails when the input does not have exactly expectCount mutations.
+// The batches yielded before the failure are not revoked.
+func readBatches(source mutationSource, size, partitions, expectCount int) iter.Seq2[mutationBatch, error] {
+	return func(yield func(mutationBatch, error) bool) {
+		var count, index int
+		pending := make([]mutationBatch, max(partitions, 1))
+		for i := range pending {
+			pending[i].partition = i
+		}
+		for {
+			entry, err := source.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				yield(mutationBatch{}, err)
+				return
+			}
+
+			count++
+			if expectCount > 0 && count > expectCount {
+				yield(mutationBatch{}, fmt.Errorf("the input has more entities than --expect-count=%d", expectCount))
+				return
+			}
+
+			batch := &pending[keyPartition(entry.key, count-1, len(pending))]
+			batch.add(entry)
+			if len(batch.mutations) == size {
+				batch.index = index
+				index++
+				if !yield(*batch, nil) {
+					return
+				}
+				*batch = mutationBatch{partition: batch.partition}
+			}
+		}
+		if expectCount > 0 && count != expectCount {
+			// the partial batches are not committed, but the full batches before have already been
+			var uncommitted int
+			for _, batch := range pending {
+				uncommitted += len(batch.mutations)
+			}
+			yield(mutationBatch{}, fmt.Errorf("the input has %d entities but --expect-count=%d (the last %d entities are not committed)", count, expectCount, uncommitted))
+			return
+		}
+		for _, batch := range pending {
+			if len(batch.mutations) == 0 {
+				continue
+			}
+			batch.index = index
+			index++
+			if !yield(batch, nil) {
+				return
+			}
+		}
+	}
+}
+
+// keyPartition returns the partition of the key at the index of the input.
+func keyPartition(key *datastore.Key, index, partitions int) int {
+	if partitions <= 1 {
+		return 0
+	}
+	if key.Incomplete() {
+		// they would all have the same hash and be committed by a single worker
+		return index % partitions
+	}
+	h := fnv.New32a()
+	_, _ = io.WriteString(h, key.String())
+	return int(h.Sum32() % uint32(partitions))
+}
+
+// keyLabel formats the key for confirmation.
+// An incomplete key would be formatted as a key with an empty name, so it is labeled by its kind instead.
+func keyLabel(key *datastore.Key) string {
+	if !key.Incomplete() {
+		return key.String()
+	}
+	label := "incomplete key of " + key.Kind
+	if key.Parent != nil {
+		label += " under " + key.Parent.String()
+	}
+	return label
+}
+
+type mutationRunner struct {
+	client         *datastore.Client
+	batchSize      int
+	parallelism    int
+	expectCount    int
+	checkpoint     string
+	silent         bool
+	force          bool
+	dryRun         bool
+	stdout         io.Writer
+	askCommit      bool
+	operation      string
+	confirmMessage string
+	listLimit      int
+
+	// commitFunc commits a batch instead of committing it in a transaction if specified
+	commitFunc func(context.Context, mutationBatch) error
+}
+
+func (r *mutationRunner) run(ctx context.Context, source mutationSource) error {
+	if r.batchSize < 0 {
+		return fmt.Errorf("--batch-size must be a positive integer: %d", r.batchSize)
+	}
+	if r.dryRun {
+		return r.runDryRun(ctx, source)
+	}
+	if r.batchSize == 0 {
+		if r.parallelism > 1 {
+			return fmt.Errorf("--parallelism requires --batch-size")
+		}
+		if r.checkpoint != "" {
+			return fmt.Errorf("--checkpoint requires --batch-size")
+		}
+		return r.runInTransaction(ctx, source)
+	}
+	return r.runInBatches(ctx, source)
+}
+
+func (r *mutationRunner) runInTransaction(ctx context.Context, source mutationSource) error {
+	var batch mutationBatch
+	for {
+		entry, err := source.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+		batch.add(entry)
+	}
+
+	// pre confirmation
+	if !r.silent {
+		log.Printf("%d keys to %s:", len(batch.keys), r.operation)
+		for _, key := range batch.keys {
+			log.Println(keyLabel(key))
+		}
+	}
+	if !r.force && !confirm(r.confirmMessage) {
+		return fmt.Errorf("aborted")
+	}
+
+	if r.commitFunc != nil {
+		if r.askCommit && !confirm("Commit?") {
+			return fmt.Errorf("aborted")
+		}
+		return r.commitFunc(ctx, batch)
+	}
+
+	if _, err := r.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		if _, err := tx.Mutate(batch.mutations...); err != nil {
+			return fmt.Errorf("client.Mutate: %w", err)
+		}
+
+		// post confirmation
+		if r.askCommit && !confirm("Commit?") {
+			return fmt.Errorf("aborted")
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("client.RunInTransaction: %w", err)
+	}
+	return nil
+}
+
+func (r *mutationRunner) runInBatches(ctx context.Context, source mutationSource) error {
+	var cp *checkpoint
+	if r.checkpoint != "" {
+		var err error
+		header := checkpointHeader{
+			Operation:   r.operation,
+			BatchSize:   r.batchSize,
+			Parallelism: max(r.parallelism, 1),
+		}
+		if in, ok := source.(checkpointInputSource); ok {
+			header.Input = in.checkpointInput()
+		}
+		cp, err = openCheckpoint(r.checkpoint, header)
+		if err != nil {
+			return err
+		}
+		defer cp.Close()
+		if len(cp.committed) != 0 {
+			log.Printf("resuming from checkpoint %s: %d batches have already been committed", r.checkpoint, len(cp.committed))
+		}
+	}
+
+	// pre confirmation
+	total := r.expectCount
+	if !r.force {
+		if total <= 0 {
+			n, err := r.prescan(source)
+			if err != nil {
+				return err
+			}
+			total = n
+		}
+
+		log.Printf("%d keys to %s in batches of %d", total, r.operation, r.batchSize)
+		if !confirm(r.confirmMessage) {
+			return fmt.Errorf("aborted")
+		}
+	}
+	if r.askCommit && !confirm(fmt.Sprintf("Commit %d mutations in batches of %d?", total, r.batchSize)) {
+		return fmt.Errorf("aborted")
+	}
+
+	return r.commitBatches(ctx, r.inputBatches(source), total, cp)
+}
+
+// inputBatches reads the batches from the source. Only --expect-count is enforced, and not the count by prescan,
+// because the source may change after it (e.g. entities matching the query to delete are created or deleted).
+func (r *mutationRunner) inputBatches(source mutationSource) iter.Seq2[mutationBatch, error] {
+	return readBatches(source, r.batchSize, r.parallelism, r.expectCount)
+}
+
+// prescan counts mutations in the source and rewinds it.
+// Streaming input cannot be held in memory, so the keys are only listed here.
+// If listLimit is positive, only the first listLimit keys are listed as a sample.
+func (r *mutationRunner) prescan(source mutationSource) (int, error) {
+	rs, ok := source.(rewindableSource)
+	if !ok || !rs.rewindable() {
+		return 0, fmt.Errorf("cannot count the input for confirmation because it is not seekable, specify --expect-count or --force")
+	}
+
+	if !r.silent {
+		log.Printf("keys to %s:", r.operation)
+	}
+	var n int
+	for {
+		entry, err := rs.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+		if !r.silent && (r.listLimit <= 0 || n < r.listLimit) {
+			log.Println(keyLabel(entry.key))
+		}
+		n++
+	}
+	if !r.silent && r.listLimit > 0 && n > r.listLimit {
+		log.Printf("... and %d more keys", n-r.listLimit)
+	}
+	if err := rs.Rewind(); err != nil {
+		return 0, fmt.Errorf("rewind input: %w", err)
+	}
+	return n, nil
+}
+
+// commitBatches commits each batch in its own transaction by the workers.
+// Reading the next batch overlaps with committing, and each worker receives
+// one batch at a time, so that memory usage is bounded by the batch size and
+// the parallelism. Batches of the same partition are committed by the same
+// worker in order, but batches of different partitions may be committed in any order.
+// If the checkpoint is given, batches recorded in it are skipped and committed batches are recorded to it.
+func (r *mutationRunner) commitBatches(ctx context.Context, batches iter.Seq2[mutationBatch, error], total int, cp *checkpoint) error {
+	var mu sync.Mutex
+	var errs []error
+	report := batchReport{totalMutations: total}
+
+	// stop reading and committing further batches after the first failure,
+	// but let in-flight commits finish so that the report is accurate
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+
+	var wg sync.WaitGroup
+	workers := make([]chan mutationBatch, max(r.parallelism, 1))
+	for i := range workers {
+		workers[i] = make(chan mutationBatch)
+		wg.Go(func() {
+			for batch := range workers[i] {
+				select {
+				case <-stop:
+					continue
+				default:
+				}
+
+				err := r.commitBatch(ctx, batch)
+
+				mu.Lock()
+				if err != nil {
+					log.Printf("batch %d failed: %v", batch.index+1, err)
+					errs = append(errs, fmt.Errorf("batch %d (%s..%s): %w", batch.index+1, batch.keys[0].String(), batch.keys[len(batch.keys)-1].String(), err))
+					stopOnce.Do(func() { close(stop) })
+				} else {
+					report.add(batch)
+					if !r.silent {
+						log.Printf("batch %d: committed %d mutations (%s)", batch.index+1, len(batch.mutations), report.progress())
+					}
+					if cp != nil {
+						if err := cp.record(batch); err != nil {
+							errs = append(errs, fmt.Errorf("record batch %d to checkpoint: %w", batch.index+1, err))
+							stopOnce.Do(func() { close(stop) })
+						}
+					}
+				}
+				mu.Unlock()
+			}
+		})
+	}
+
+	var readErr error
+read:
+	for batch, err := range batches {
+		if err != nil {
+			readErr = err
+			break
+		}
+		if cp != nil {
+			batch.fingerprint = batchFingerprint(batch)
+			done, err := cp.done(batch)
+			if err != nil {
+				readErr = err
+				break
+			}
+			if done {
+				mu.Lock()
+				report.add(batch)
+				mu.Unlock()
+				if !r.silent {
+					log.Printf("batch %d: skipped because it has already been committed", batch.index+1)
+				}
+				continue
+			}
+		}
+		select {
+		case workers[batch.partition] <- batch:
+		case <-stop:
+			break read
+		case <-ctx.Done():
+			readErr = ctx.Err()
+			break read
+		}
+	}
+	for _, ch := range workers {
+		close(ch)
+	}
+	wg.Wait()
+
+	if err := errors.Join(append(errs, readErr)...); err != nil {
+		log.Println(report.String())
+		return err
+	}
+	return nil
+}
+
+func (r *mutationRunner) commitBatch(ctx context.Context, batch mutationBatch) error {
+	if r.commitFunc != nil {
+		return r.commitFunc(ctx, batch)
+	}
+	return r.commitInTransaction(ctx, batch)
+}
+
+func (r *mutationRunner) commitInTransaction(ctx context.Context, batch mutationBatch) error {
+	if _, err := r.client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		if _, err := tx.Mutate(batch.mutations...); err != nil {
+			return fmt.Errorf("client.Mutate: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("client.RunInTransaction: %w", err)
+	}
+	return nil
+}
+
+// batchReport tracks which batches have been committed, so that a failed run
+// can tell which part of the input has already been applied.
+type batchReport struct {
+	totalMutations     int
+	committed          []int
+	committedMutations int
+}
+
+func (r *batchReport) add(batch mutationBatch) {
+	r.committed = append(r.committed, batch.index)
+	r.committedMutations += len(batch.mutations)
+}
+
+func (r *batchReport) progress() string {
+	if r.totalMutations <= 0 {
+		return strconv.Itoa(r.committedMutations) + " mutations"
+	}
+	return fmt.Sprintf("%d/%d mutations", r.committedMutations, r.totalMutations)
+}
+
+func (r *batchReport) String() string {
+	if len(r.committed) == 0 {
+		return fmt.Sprintf("no batches committed (%s)", r.progress())
+	}
+	return fmt.Sprintf("committed batches: %s (%s)", formatBatchRanges(r.committed), r.progress())
+}
+
+// formatBatchRanges formats 0-origin batch indexes as 1-origin ranges (e.g. "1-3,5")
+func formatBatchRanges(indexes []int) string {
+	indexes = slices.Sorted(slices.Values(indexes))
+
+	var s strings.Builder
+	for i := 0; i < len(indexes); {
+		j := i
+		for j+1 < len(indexes) && indexes[j+1] == indexes[j]+1 {
+			j++
+		}
+		if s.Len() != 0 {
+			s.WriteByte(',')
+		}
+		s.WriteString(strconv.Itoa(indexes[i] + 1))
+		if j != i {
+			s.WriteByte('-')
+			s.WriteString(strconv.Itoa(indexes[j] + 1))
+		}
+		i = j + 1
+	}
+	return s.String()
+}
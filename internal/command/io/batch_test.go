@@ -0,0 +1,271 @@
+package io
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+func newTestKeySource(n int) *keySource {
+	keys := make(datastore.Keys, n)
+	for i := range keys {
+		keys[i] = &datastore.Key{Kind: "Task", ID: int64(i + 1)}
+	}
+	return &keySource{
+		keys: keys,
+		newMutation: func(key *datastore.Key) *datastore.Mutation {
+			return datastore.NewDelete(key.ToDatastore())
+		},
+	}
+}
+
+func TestReadBatches(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		size        int
+		expectCount int
+		want        [][]int64
+		wantErr     bool
+	}{
+		{size: 1, want: [][]int64{{1}, {2}, {3}, {4}, {5}}},
+		{size: 2, want: [][]int64{{1, 2}, {3, 4}, {5}}},
+		{size: 5, want: [][]int64{{1, 2, 3, 4, 5}}},
+		{size: 10, want: [][]int64{{1, 2, 3, 4, 5}}},
+		{size: 2, expectCount: 5, want: [][]int64{{1, 2}, {3, 4}, {5}}},
+		{size: 2, expectCount: 3, want: [][]int64{{1, 2}}, wantErr: true},
+		{size: 2, expectCount: 6, want: [][]int64{{1, 2}, {3, 4}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.size)+"/"+strconv.Itoa(tt.expectCount), func(t *testing.T) {
+			t.Parallel()
+
+			var got [][]int64
+			var gotErr error
+			for batch, err := range readBatches(newTestKeySource(5), tt.size, 1, tt.expectCount) {
+				if err != nil {
+					gotErr = err
+					break
+				}
+				if batch.index != len(got) {
+					t.Errorf("batches[%d].index = %d", len(got), batch.index)
+				}
+				if len(batch.keys) != len(batch.mutations) {
+					t.Errorf("batches[%d] has %d keys and %d mutations", len(got), len(batch.keys), len(batch.mutations))
+				}
+				ids := make([]int64, len(batch.keys))
+				for i, key := range batch.keys {
+					ids[i] = key.ID
+				}
+				got = append(got, ids)
+			}
+			if (gotErr != nil) != tt.wantErr {
+				t.Errorf("readBatches() error = %v, wantErr %v", gotErr, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected batches (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadBatches_Partitions(t *testing.T) {
+	t.Parallel()
+
+	// the same keys appear twice to check that they go to the same partition in input order
+	source := newTestKeySource(20)
+	source.keys = append(source.keys, source.keys...)
+
+	const partitions = 3
+	seen := map[int64]int{}
+	var count int
+	for batch, err := range readBatches(source, 4, partitions, 0) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if batch.index != count {
+			t.Errorf("batch.index = %d, want %d", batch.index, count)
+		}
+		count++
+		if batch.partition < 0 || batch.partition >= partitions {
+			t.Fatalf("batch.partition = %d", batch.partition)
+		}
+		for _, key := range batch.keys {
+			if got := keyPartition(key, 0, partitions); got != batch.partition {
+				t.Errorf("key %s is in partition %d, want %d", key.String(), batch.partition, got)
+			}
+			seen[key.ID]++
+		}
+	}
+	for id := int64(1); id <= 20; id++ {
+		if seen[id] != 2 {
+			t.Errorf("key %d appeared %d times, want 2", id, seen[id])
+		}
+	}
+}
+
+func TestReadBatches_IncompleteKeys(t *testing.T) {
+	t.Parallel()
+
+	source := &keySource{
+		keys: make(datastore.Keys, 12),
+		newMutation: func(key *datastore.Key) *datastore.Mutation {
+			return datastore.NewInsert(key.ToDatastore(), &datastore.Entity{Key: key})
+		},
+	}
+	for i := range source.keys {
+		source.keys[i] = &datastore.Key{Kind: "Task"}
+	}
+
+	const partitions = 3
+	sizes := make([]int, partitions)
+	for batch, err := range readBatches(source, 2, partitions, 0) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[batch.partition] += len(batch.keys)
+	}
+	if diff := cmp.Diff([]int{4, 4, 4}, sizes); diff != "" {
+		t.Errorf("unexpected keys per partition (-want +got):\n%s", diff)
+	}
+}
+
+func TestKeyLabel(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		key  *datastore.Key
+		want string
+	}{
+		{key: &datastore.Key{Kind: "Task", ID: 1}, want: "KEY(Task,1)"},
+		{key: &datastore.Key{Kind: "Task"}, want: "incomplete key of Task"},
+		{key: &datastore.Key{Kind: "Task", Parent: &datastore.Key{Kind: "User", Name: "alice"}}, want: `incomplete key of Task under KEY(User,"alice")`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			t.Parallel()
+
+			if got := keyLabel(tt.key); got != tt.want {
+				t.Errorf("keyLabel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchReport(t *testing.T) {
+	t.Parallel()
+
+	report := batchReport{totalMutations: 11}
+	if got, want := report.String(), "no batches committed (0/11 mutations)"; got != want {
+		t.Errorf("report.String() = %q, want %q", got, want)
+	}
+
+	for _, index := range []int{4, 0, 1, 2} {
+		report.add(mutationBatch{index: index, mutations: make([]*datastore.Mutation, 2)})
+	}
+	if got, want := report.String(), "committed batches: 1-3,5 (8/11 mutations)"; got != want {
+		t.Errorf("report.String() = %q, want %q", got, want)
+	}
+
+	unknownTotal := batchReport{}
+	unknownTotal.add(mutationBatch{index: 0, mutations: make([]*datastore.Mutation, 3)})
+	if got, want := unknownTotal.String(), "committed batches: 1 (3 mutations)"; got != want {
+		t.Errorf("report.String() = %q, want %q", got, want)
+	}
+}
+
+func TestMutationRunnerRun_InvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		runner *mutationRunner
+	}{
+		{name: "negative batch size", runner: &mutationRunner{batchSize: -1}},
+		{name: "parallelism without batch size", runner: &mutationRunner{parallelism: 2}},
+		{name: "checkpoint without batch size", runner: &mutationRunner{checkpoint: "checkpoint.jsonl"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := tt.runner.run(context.Background(), newTestKeySource(1)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+// changingKeySource is a keySource whose keys change on rewind, like a query whose matching entities are changed.
+type changingKeySource struct {
+	*keySource
+	change func(datastore.Keys) datastore.Keys
+}
+
+func (s *changingKeySource) Rewind() error {
+	s.keys = s.change(s.keys)
+	return s.keySource.Rewind()
+}
+
+func TestMutationRunner_SourceChangedAfterPrescan(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		change func(datastore.Keys) datastore.Keys
+		want   int
+	}{
+		{
+			name: "more",
+			change: func(keys datastore.Keys) datastore.Keys {
+				return append(keys, &datastore.Key{Kind: "Task", ID: int64(len(keys) + 1)})
+			},
+			want: 11,
+		},
+		{
+			name: "fewer",
+			change: func(keys datastore.Keys) datastore.Keys {
+				return keys[1:]
+			},
+			want: 9,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var mu sync.Mutex
+			var committed int
+			r := &mutationRunner{
+				batchSize:   3,
+				parallelism: 2,
+				silent:      true,
+				commitFunc: func(_ context.Context, batch mutationBatch) error {
+					mu.Lock()
+					defer mu.Unlock()
+					committed += len(batch.mutations)
+					return nil
+				},
+			}
+			source := &changingKeySource{keySource: newTestKeySource(10), change: tt.change}
+			total, err := r.prescan(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != 10 {
+				t.Errorf("prescan() = %d, want 10", total)
+			}
+			if err := r.commitBatches(t.Context(), r.inputBatches(source), total, nil); err != nil {
+				t.Fatal(err)
+			}
+			if committed != tt.want {
+				t.Errorf("committed %d mutations, want %d", committed, tt.want)
+			}
+		})
+	}
+}
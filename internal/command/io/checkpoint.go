@@ -0,0 +1,163 @@
+package io
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"time"
+)
+
+// checkpoint records committed batches to a file as JSON Lines, so that an
+// interrupted run can be resumed by skipping them. The first line is a header
+// with the parameters which determine how the input is split into batches,
+// and each following line is a committed batch with the fingerprint of its keys
+// to detect a different input on resume.
+type checkpoint struct {
+	file    *os.File
+	encoder *json.Encoder
+
+	// committed is the batches committed by the previous runs. It is read-only after loading,
+	// because it is read by the reader of batches while the workers record committed batches.
+	committed map[int]string
+}
+
+type checkpointHeader struct {
+	Operation   string          `json:"operation"`
+	BatchSize   int             `json:"batchSize"`
+	Parallelism int             `json:"parallelism"`
+	Input       checkpointInput `json:"input,omitzero"`
+}
+
+// checkpointInput is the identity of the input file. It is zero if the input is not a regular file (e.g. a pipe).
+type checkpointInput struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+func newCheckpointInput(file *os.File) checkpointInput {
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return checkpointInput{}
+	}
+	return checkpointInput{Path: file.Name(), Size: info.Size(), ModTime: info.ModTime().UTC()}
+}
+
+func (i checkpointInput) equal(o checkpointInput) bool {
+	return i.Path == o.Path && i.Size == o.Size && i.ModTime.Equal(o.ModTime)
+}
+
+func (i checkpointInput) String() string {
+	if i == (checkpointInput{}) {
+		return "a non-file input"
+	}
+	return fmt.Sprintf("%s (%d bytes, modified at %s)", i.Path, i.Size, i.ModTime.Format(time.RFC3339Nano))
+}
+
+type checkpointRecord struct {
+	Batch       int    `json:"batch"`
+	Mutations   int    `json:"mutations"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// batchFingerprint returns the hash of the keys in the batch. It must be taken before the keys are completed.
+func batchFingerprint(batch mutationBatch) string {
+	h := fnv.New64a()
+	for _, key := range batch.keys {
+		_, _ = io.WriteString(h, key.String())
+		_, _ = h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// openCheckpoint opens the checkpoint file or creates it if not exists.
+// It fails if the existing checkpoint was written with different parameters,
+// because batches would not be the same.
+func openCheckpoint(path string, header checkpointHeader) (*checkpoint, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &checkpoint{file: file, encoder: json.NewEncoder(file), committed: map[int]string{}}
+	if err := c.load(header); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("checkpoint %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func (c *checkpoint) load(header checkpointHeader) error {
+	decoder := json.NewDecoder(c.file)
+
+	var saved checkpointHeader
+	if err := decoder.Decode(&saved); errors.Is(err, io.EOF) {
+		// new checkpoint
+		if err := c.encoder.Encode(header); err != nil {
+			return err
+		}
+		return c.file.Sync()
+	} else if err != nil {
+		return err
+	}
+	if saved.Operation != header.Operation || saved.BatchSize != header.BatchSize || saved.Parallelism != header.Parallelism {
+		return fmt.Errorf("written by %s with --batch-size=%d --parallelism=%d, but the current run is %s with --batch-size=%d --parallelism=%d",
+			saved.Operation, saved.BatchSize, saved.Parallelism, header.Operation, header.BatchSize, header.Parallelism)
+	}
+	if !saved.Input.equal(header.Input) {
+		return fmt.Errorf("written for %s, but the current input is %s", saved.Input, header.Input)
+	}
+
+	for {
+		offset := decoder.InputOffset()
+
+		var record checkpointRecord
+		if err := decoder.Decode(&record); errors.Is(err, io.EOF) {
+			break
+		} else if errors.Is(err, io.ErrUnexpectedEOF) {
+			// the last record was partially written by an interrupted run, so discard it
+			if err := c.file.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		} else if err != nil {
+			return err
+		}
+		c.committed[record.Batch] = record.Fingerprint
+	}
+
+	// append records after the loaded ones
+	_, err := c.file.Seek(0, io.SeekEnd)
+	return err
+}
+
+// done reports whether the batch has been committed by the previous runs.
+// It fails if the batch has different keys from the committed one, because the input has been changed.
+func (c *checkpoint) done(batch mutationBatch) (bool, error) {
+	fingerprint, ok := c.committed[batch.index]
+	if !ok {
+		return false, nil
+	}
+	if fingerprint != batch.fingerprint {
+		return false, fmt.Errorf("batch %d (%s..%s) has different keys from the committed one, the input seems to be changed",
+			batch.index+1, batch.keys[0].String(), batch.keys[len(batch.keys)-1].String())
+	}
+	return true, nil
+}
+
+// record appends the committed batch to the file. The batch is never read again in the current run,
+// so it is not added to the committed batches.
+func (c *checkpoint) record(batch mutationBatch) error {
+	if err := c.encoder.Encode(checkpointRecord{Batch: batch.index, Mutations: len(batch.mutations), Fingerprint: batch.fingerprint}); err != nil {
+		return err
+	}
+	return c.file.Sync()
+}
+
+func (c *checkpoint) Close() error {
+	return c.file.Close()
+}
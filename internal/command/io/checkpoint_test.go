@@ -0,0 +1,199 @@
+package io
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+// newTestCheckpointBatch creates a batch of two keys with its fingerprint.
+func newTestCheckpointBatch(index int) mutationBatch {
+	batch := mutationBatch{
+		index:     index,
+		keys:      datastore.Keys{{Kind: "Task", ID: int64(index*2 + 1)}, {Kind: "Task", ID: int64(index*2 + 2)}},
+		mutations: make([]*datastore.Mutation, 2),
+	}
+	batch.fingerprint = batchFingerprint(batch)
+	return batch
+}
+
+func TestCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	header := checkpointHeader{Operation: "upsert", BatchSize: 2, Parallelism: 1}
+
+	cp, err := openCheckpoint(path, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range []int{0, 2} {
+		if err := cp.record(newTestCheckpointBatch(index)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a record partially written by an interrupted run
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"batch":3,"mut`); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cp, err = openCheckpoint(path, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for index, want := range []bool{true, false, true, false} {
+		if got, err := cp.done(newTestCheckpointBatch(index)); err != nil {
+			t.Fatal(err)
+		} else if got != want {
+			t.Errorf("done(%d) = %v, want %v", index, got, want)
+		}
+	}
+	if err := cp.record(newTestCheckpointBatch(1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cp, err = openCheckpoint(path, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cp.Close()
+	for index, want := range []bool{true, true, true, false} {
+		if got, err := cp.done(newTestCheckpointBatch(index)); err != nil {
+			t.Fatal(err)
+		} else if got != want {
+			t.Errorf("done(%d) = %v, want %v after resume", index, got, want)
+		}
+	}
+
+	// the committed batch with different keys
+	changed := newTestCheckpointBatch(0)
+	changed.keys = changed.keys[:1]
+	changed.fingerprint = batchFingerprint(changed)
+	if _, err := cp.done(changed); err == nil {
+		t.Error("done() with different keys should fail")
+	}
+}
+
+// TestCommitBatches_Checkpoint resumes an interrupted run with the checkpoint. Run it with -race to
+// check the reader of batches and the workers do not share the checkpoint unsafely.
+func TestCommitBatches_Checkpoint(t *testing.T) {
+	t.Parallel()
+
+	const n = 2000
+	path := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	header := checkpointHeader{Operation: "delete", BatchSize: 1, Parallelism: 2}
+	run := func(fail int) (map[int]bool, error) {
+		cp, err := openCheckpoint(path, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cp.Close()
+
+		var mu sync.Mutex
+		committed := map[int]bool{}
+		r := &mutationRunner{
+			batchSize:   header.BatchSize,
+			parallelism: header.Parallelism,
+			silent:      true,
+			commitFunc: func(_ context.Context, batch mutationBatch) error {
+				if batch.index == fail {
+					return errors.New("interrupted")
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				committed[batch.index] = true
+				return nil
+			},
+		}
+		err = r.commitBatches(t.Context(), readBatches(newTestKeySource(n), header.BatchSize, header.Parallelism, 0), n, cp)
+		return committed, err
+	}
+
+	first, err := run(n / 2)
+	if err == nil {
+		t.Fatal("expected an error for the interrupted run")
+	}
+	second, err := run(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for index := range n {
+		switch {
+		case first[index] && second[index]:
+			t.Errorf("batch %d is committed twice", index)
+		case !first[index] && !second[index]:
+			t.Errorf("batch %d is not committed", index)
+		}
+	}
+}
+
+func TestCheckpoint_HeaderMismatch(t *testing.T) {
+	t.Parallel()
+
+	input := filepath.Join(t.TempDir(), "input.jsonl")
+	if err := os.WriteFile(input, []byte("{}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	newHeader := func(batchSize int) checkpointHeader {
+		f, err := os.Open(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		return checkpointHeader{Operation: "upsert", BatchSize: batchSize, Parallelism: 1, Input: newCheckpointInput(f)}
+	}
+
+	path := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	header := newHeader(2)
+	if header.Input.Path != input {
+		t.Fatalf("unexpected input: %s", header.Input)
+	}
+	cp, err := openCheckpoint(path, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cp, err = openCheckpoint(path, newHeader(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openCheckpoint(path, newHeader(3)); err == nil {
+		t.Error("openCheckpoint() with different batch size should fail")
+	}
+
+	// the input is changed
+	if err := os.WriteFile(input, []byte("{}\n{}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openCheckpoint(path, newHeader(2)); err == nil {
+		t.Error("openCheckpoint() with changed input should fail")
+	}
+	if _, err := openCheckpoint(path, checkpointHeader{Operation: "upsert", BatchSize: 2, Parallelism: 1}); err == nil {
+		t.Error("openCheckpoint() with non-file input should fail")
+	}
+}
@@ -1,11 +1,16 @@
 package io
 
 type Commands struct {
-	Lookup LookupCommand `cmd:""`
-	Query  QueryCommand  `cmd:""`
-	Insert InsertCommand `cmd:""`
-	Update UpdateCommand `cmd:""`
-	Upsert UpsertCommand `cmd:""`
-	Delete DeleteCommand `cmd:""`
-	GQL    GQLCommand    `cmd:""`
+	Lookup  LookupCommand  `cmd:""`
+	Query   QueryCommand   `cmd:""`
+	Insert  InsertCommand  `cmd:""`
+	Update  UpdateCommand  `cmd:""`
+	Upsert  UpsertCommand  `cmd:""`
+	Patch   PatchCommand   `cmd:""`
+	Delete  DeleteCommand  `cmd:""`
+	GQL     GQLCommand     `cmd:""`
+	Schema  SchemaCommand  `cmd:""`
+	Stats   StatsCommand   `cmd:""`
+	History HistoryCommand `cmd:""`
+	Export  ExportCommand  `cmd:""`
 }
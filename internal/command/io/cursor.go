@@ -0,0 +1,60 @@
+package io
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+type CursorOptions struct {
+	// StartCursor is the cursor to start the query from
+	StartCursor string `name:"start-cursor" optional:"" group:"Cursor" help:"Cursor to start the query from (e.g. the next page cursor of the previous query)"`
+
+	// EndCursor is the cursor to end the query at
+	EndCursor string `name:"end-cursor" optional:"" group:"Cursor" help:"Cursor to end the query at"`
+
+	// EmitCursor is where to emit the next page cursor
+	EmitCursor string `name:"emit-cursor" enum:",stderr,record" default:"" placeholder:"stderr|record" group:"Cursor" help:"Emit the next page cursor to stderr, or to stdout as a trailing JSON record ({\"cursor\":\"...\"})"`
+}
+
+func (o *CursorOptions) specified() bool {
+	return o.StartCursor != "" || o.EndCursor != "" || o.EmitCursor != ""
+}
+
+// applyCursors sets the start and end cursors to the query.
+func (o *CursorOptions) applyCursors(query *datastore.Query) (*datastore.Query, error) {
+	if o.StartCursor != "" {
+		cursor, err := datastore.DecodeCursor(o.StartCursor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start cursor: %w", err)
+		}
+		query = query.Start(cursor)
+	}
+	if o.EndCursor != "" {
+		cursor, err := datastore.DecodeCursor(o.EndCursor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end cursor: %w", err)
+		}
+		query = query.End(cursor)
+	}
+	return query, nil
+}
+
+// emitCursor writes the cursor after the last result if --emit-cursor is specified.
+func (o *CursorOptions) emitCursor(stdout, stderr io.Writer, cursor datastore.Cursor) error {
+	switch o.EmitCursor {
+	case "":
+		return nil
+	case "stderr":
+		_, err := fmt.Fprintln(stderr, cursor.String())
+		return err
+	case "record":
+		return json.NewEncoder(stdout).Encode(struct {
+			Cursor string `json:"cursor"`
+		}{Cursor: cursor.String()})
+	default:
+		panic("unknown cursor output: " + o.EmitCursor)
+	}
+}
@@ -3,19 +3,29 @@ package io
 import (
 	"context"
 	"fmt"
-	"log"
 
 	"github.com/karupanerura/dutil/internal/command"
 	"github.com/karupanerura/dutil/internal/datastore"
 	"github.com/karupanerura/dutil/internal/parser"
 )
 
+// maxCommitMutations is the maximum number of mutations in a single commit
+const maxCommitMutations = 500
+
+// deleteSampleKeys is the number of keys listed in the confirmation of delete-by-query
+const deleteSampleKeys = 10
+
 type DeleteCommand struct {
 	DatastoreOptions
-	Keys   []string `arg:"" name:"keys" help:"Keys to delete (format: https://support.google.com/cloud/answer/6361641)"`
-	Force  bool     `name:"force" short:"f" optional:"" env:"DATASTORE_CLI_FORCE_DELETE" help:"Force delete without confirmation"`
-	Commit bool     `name:"commit" short:"c" optional:"" help:"Commit transaction without confirmation"`
-	Silent bool     `name:"silent" short:"s" optional:"" help:"Silent mode"`
+	BatchOptions
+	Keys        []string `arg:"" name:"keys" optional:"" help:"Keys to delete (format: https://support.google.com/cloud/answer/6361641). If omitted, keys are read from stdin in any key format or entity JSON Lines"`
+	Force       bool     `name:"force" short:"f" optional:"" env:"DATASTORE_CLI_FORCE_DELETE" help:"Force delete without confirmation"`
+	Commit      bool     `name:"commit" short:"c" optional:"" help:"Commit transaction without confirmation"`
+	Silent      bool     `name:"silent" short:"s" optional:"" help:"Silent mode"`
+	QueryKind   string   `name:"query-kind" optional:"" group:"Query" help:"Delete entities of the kind matching --ancestor and --filter instead of the keys"`
+	AncestorKey string   `name:"ancestor" optional:"" group:"Query" help:"Ancestor key to query (format: https://support.google.com/cloud/answer/6361641)"`
+	Filter      string   `name:"filter" optional:"" group:"Query" help:"Entity filter query (format: GQL compound-condition https://cloud.google.com/datastore/docs/reference/gql_reference)"`
+	GQL         string   `name:"gql" optional:"" group:"Query" help:"Delete entities matching the GQL query instead of the keys"`
 }
 
 func (r *DeleteCommand) Run(ctx context.Context, opts command.GlobalOptions) error {
@@ -25,37 +35,80 @@ func (r *DeleteCommand) Run(ctx context.Context, opts command.GlobalOptions) err
 	}
 	defer client.Close()
 
+	newMutation := func(key *datastore.Key) *datastore.Mutation {
+		return datastore.NewDelete(key.ToDatastore())
+	}
 	keyParser := &parser.KeyParser{Namespace: r.Namespace}
-	keys, err := keyParser.ParseKeys(r.Keys)
-	if err != nil {
-		return fmt.Errorf("keyParser.ParseKeys: %w", err)
+	runner := &mutationRunner{
+		client:         client,
+		batchSize:      r.BatchSize,
+		parallelism:    r.Parallelism,
+		expectCount:    r.ExpectCount,
+		checkpoint:     r.Checkpoint,
+		silent:         r.Silent,
+		force:          r.Force,
+		askCommit:      !r.Force && !r.Commit,
+		operation:      "delete",
+		confirmMessage: "Delete these entities?",
 	}
 
-	// pre confirmation
-	if !r.Silent {
-		log.Printf("%d keys to delete:", len(keys))
-		for _, key := range keys {
-			log.Println(key.String())
+	var source mutationSource
+	switch {
+	case r.QueryKind != "" || r.GQL != "":
+		if len(r.Keys) != 0 {
+			return fmt.Errorf("keys cannot be specified with --query-kind or --gql")
 		}
-	}
-	if !r.Force && !confirm("Delete these entities?") {
-		return fmt.Errorf("aborted")
-	}
+		if r.Checkpoint != "" {
+			// the query result changes as the entities are deleted, so the batches cannot be matched on resume
+			return fmt.Errorf("--checkpoint cannot be specified with --query-kind or --gql")
+		}
+		query, err := r.newQuery()
+		if err != nil {
+			return err
+		}
+		qs := newQuerySource(ctx, newQueryScanner(ctx, client), query, newMutation)
+		defer qs.Close()
+		source = qs
 
-	if _, err = client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
-		if err := tx.DeleteMulti(keys.ToDatastore()); err != nil {
-			return fmt.Errorf("client.DeleteMulti: %w", err)
+		// the query result can be too large to commit at once and to list all
+		if runner.batchSize == 0 {
+			runner.batchSize = maxCommitMutations
 		}
+		runner.listLimit = deleteSampleKeys
+	case r.AncestorKey != "" || r.Filter != "":
+		return fmt.Errorf("--ancestor and --filter require --query-kind")
+	case len(r.Keys) == 0:
+		source, err = newKeyReaderSource(opts.Stdin, keyParser, newMutation)
+		if err != nil {
+			return err
+		}
+	default:
+		keys, err := keyParser.ParseKeys(r.Keys)
+		if err != nil {
+			return fmt.Errorf("keyParser.ParseKeys: %w", err)
+		}
+		source = &keySource{keys: keys, newMutation: newMutation}
+	}
+
+	return runner.run(ctx, source)
+}
 
-		// post confirmation
-		if !r.Force && !r.Commit && !confirm("Commit?") {
-			return fmt.Errorf("aborted")
+// newQuery creates the query specified by --query-kind or --gql.
+func (r *DeleteCommand) newQuery() (*datastore.Query, error) {
+	if r.GQL != "" {
+		if r.QueryKind != "" || r.AncestorKey != "" || r.Filter != "" {
+			return nil, fmt.Errorf("--gql cannot be specified with --query-kind, --ancestor or --filter")
 		}
 
-		return nil
-	}); err != nil {
-		return fmt.Errorf("client.RunInTransaction: %w", err)
+		qp := &parser.QueryParser{Namespace: r.Namespace}
+		q, _, aq, err := qp.ParseGQL(r.GQL)
+		if err != nil {
+			return nil, err
+		}
+		if aq != nil {
+			return nil, fmt.Errorf("aggregation query cannot be used to delete entities")
+		}
+		return q, nil
 	}
-
-	return nil
+	return newFilteredQuery(r.QueryKind, r.Namespace, r.AncestorKey, r.Filter)
 }
@@ -0,0 +1,113 @@
+package io
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+// maxLookupKeys is the maximum number of keys in a single lookup request
+const maxLookupKeys = 1000
+
+type dryRunResult struct {
+	Key    *datastore.Key           `json:"key"`
+	Status string                   `json:"status"`
+	Diff   []datastore.PropertyDiff `json:"diff,omitempty"`
+}
+
+// runDryRun looks up the current entities for the input and writes what would
+// be changed by the operation, without committing anything.
+func (r *mutationRunner) runDryRun(ctx context.Context, source mutationSource) error {
+	size := r.batchSize
+	if size <= 0 || size > maxLookupKeys {
+		size = maxLookupKeys
+	}
+
+	counts := map[string]int{}
+	encoder := json.NewEncoder(r.stdout)
+	for batch, err := range readBatches(source, size, 1, r.expectCount) {
+		if err != nil {
+			return err
+		}
+
+		// incomplete keys are always created, so look up complete keys only
+		var keys datastore.Keys
+		var indexes []int
+		for i, key := range batch.keys {
+			if !key.Incomplete() {
+				keys = append(keys, key)
+				indexes = append(indexes, i)
+			}
+		}
+		found := make([]*datastore.Entity, len(keys))
+		if err := getMulti(ctx, r.client, keys, found); err != nil {
+			return err
+		}
+		current := make([]*datastore.Entity, len(batch.keys))
+		for i, entity := range found {
+			current[indexes[i]] = entity
+		}
+		for i, key := range batch.keys {
+			result := diffEntity(r.operation, key, current[i], batch.entities[i])
+			counts[result.Status]++
+			if err := encoder.Encode(result); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !r.silent {
+		var summary []string
+		for _, status := range slices.Sorted(maps.Keys(counts)) {
+			summary = append(summary, fmt.Sprintf("%s=%d", status, counts[status]))
+		}
+		log.Printf("dry-run %s: %s", r.operation, strings.Join(summary, " "))
+	}
+	return nil
+}
+
+// diffEntity describes what the operation would do to the current entity (nil if not exists).
+func diffEntity(operation string, key *datastore.Key, current, entity *datastore.Entity) dryRunResult {
+	result := dryRunResult{Key: key}
+	switch {
+	case current == nil && operation == "update":
+		result.Status = "missing"
+	case current == nil:
+		result.Status = "create"
+		result.Diff = datastore.DiffProperties(nil, entity.Properties)
+	case operation == "insert":
+		result.Status = "conflict"
+	default:
+		result.Diff = datastore.DiffProperties(current.Properties, entity.Properties)
+		if len(result.Diff) == 0 {
+			result.Status = "unchanged"
+		} else {
+			result.Status = "change"
+		}
+	}
+	return result
+}
+
+// getMulti looks up entities for the keys. Missing entities are left nil.
+func getMulti(ctx context.Context, client *datastore.Client, keys datastore.Keys, entities []*datastore.Entity) error {
+	if err := client.GetMulti(ctx, keys.ToDatastore(), entities); err != nil {
+		var mErr datastore.MultiError
+		if errors.As(err, &mErr) {
+			for _, err := range mErr {
+				if err != nil && !errors.Is(err, datastore.ErrNoSuchEntity) {
+					return mErr
+				}
+			}
+		} else {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package io
+
+import (
+	"testing"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+func TestDiffEntity(t *testing.T) {
+	t.Parallel()
+
+	key := &datastore.Key{Kind: "Task", Name: "foo"}
+	newEntity := func(value int64) *datastore.Entity {
+		return &datastore.Entity{Key: key, Properties: []datastore.Property{
+			{Name: "p", Value: datastore.Value{Type: datastore.IntType, Value: value}},
+		}}
+	}
+
+	tests := []struct {
+		operation  string
+		current    *datastore.Entity
+		entity     *datastore.Entity
+		wantStatus string
+		wantDiffs  int
+	}{
+		{operation: "upsert", current: nil, entity: newEntity(1), wantStatus: "create", wantDiffs: 1},
+		{operation: "upsert", current: newEntity(1), entity: newEntity(1), wantStatus: "unchanged"},
+		{operation: "upsert", current: newEntity(1), entity: newEntity(2), wantStatus: "change", wantDiffs: 1},
+		{operation: "update", current: nil, entity: newEntity(1), wantStatus: "missing"},
+		{operation: "update", current: newEntity(1), entity: newEntity(2), wantStatus: "change", wantDiffs: 1},
+		{operation: "insert", current: nil, entity: newEntity(1), wantStatus: "create", wantDiffs: 1},
+		{operation: "insert", current: newEntity(1), entity: newEntity(1), wantStatus: "conflict"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.operation+"/"+tt.wantStatus, func(t *testing.T) {
+			t.Parallel()
+
+			got := diffEntity(tt.operation, key, tt.current, tt.entity)
+			if got.Status != tt.wantStatus {
+				t.Errorf("Status = %q, want %q", got.Status, tt.wantStatus)
+			}
+			if len(got.Diff) != tt.wantDiffs {
+				t.Errorf("len(Diff) = %d, want %d", len(got.Diff), tt.wantDiffs)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package io
+
+import (
+	"fmt"
+
+	"github.com/alecthomas/kong"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+// ExplainMode is the value of --explain option.
+// --explain without value is the same as --explain=analyze for backward compatibility.
+type ExplainMode string
+
+const (
+	explainAnalyze ExplainMode = "analyze"
+	explainPlan    ExplainMode = "plan"
+)
+
+func (m *ExplainMode) Decode(ctx *kong.DecodeContext) error {
+	if ctx.Scan.Peek().Type != kong.FlagValueToken {
+		*m = explainAnalyze
+		return nil
+	}
+
+	token := ctx.Scan.Pop()
+	switch v, _ := token.Value.(string); ExplainMode(v) {
+	case explainAnalyze, explainPlan:
+		*m = ExplainMode(v)
+		return nil
+	default:
+		return fmt.Errorf("must be analyze or plan but got %q", token.Value)
+	}
+}
+
+// IsBool makes kong accept --explain without value.
+func (m *ExplainMode) IsBool() bool {
+	return true
+}
+
+func (m ExplainMode) enabled() bool {
+	return m != ""
+}
+
+// options returns the explain options. The query is executed only for analyze.
+func (m ExplainMode) options() datastore.ExplainOptions {
+	return datastore.ExplainOptions{Analyze: m == explainAnalyze}
+}
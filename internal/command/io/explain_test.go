@@ -0,0 +1,50 @@
+package io
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+)
+
+func TestExplainMode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args    []string
+		want    ExplainMode
+		wantErr bool
+	}{
+		{args: nil, want: ""},
+		{args: []string{"--explain"}, want: explainAnalyze},
+		{args: []string{"--explain=analyze"}, want: explainAnalyze},
+		{args: []string{"--explain=plan"}, want: explainPlan},
+		{args: []string{"--explain=foo"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			t.Parallel()
+
+			var cli struct {
+				Explain ExplainMode `name:"explain"`
+				Arg     string      `arg:"" optional:""`
+			}
+			parser, err := kong.New(&cli)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = parser.Parse(append(tt.args, "arg"))
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if cli.Explain != tt.want || cli.Arg != "arg" {
+				t.Errorf("unexpected result: explain=%q arg=%q", cli.Explain, cli.Arg)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	clouddatastore "cloud.google.com/go/datastore"
+
+	"github.com/karupanerura/dutil/internal/command"
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+// exportManifestFile is the name of the manifest file in the output directory.
+const exportManifestFile = "manifest.json"
+
+// ExportSpec is a kind to export with an optional filter.
+type ExportSpec struct {
+	Kind   string
+	Filter string
+}
+
+func (s *ExportSpec) UnmarshalText(text []byte) error {
+	if before, after, ok := bytes.Cut(text, []byte{'='}); ok {
+		s.Kind = string(before)
+		s.Filter = string(after)
+	} else {
+		s.Kind = string(text)
+	}
+	if s.Kind == "" {
+		return fmt.Errorf("kind must not be empty")
+	}
+	return nil
+}
+
+type ExportCommand struct {
+	DatastoreOptions
+	ReadTimeOptions
+	Specs     []ExportSpec `arg:"" name:"specs" sep:"none" placeholder:"KIND[=FILTER]" help:"Kinds to export with optional filters (format: GQL compound-condition https://cloud.google.com/datastore/docs/reference/gql_reference) (e.g. Order or 'LineItem=status = \"open\"')"`
+	OutputDir string       `name:"output-dir" short:"o" required:"" type:"path" help:"Directory to write the entities of each kind (<kind>.jsonl) and the manifest (manifest.json)"`
+}
+
+// exportManifest records the snapshot of the export. It is written after all kinds are exported.
+type exportManifest struct {
+	ReadTime   time.Time            `json:"readTime"`
+	ProjectID  string               `json:"projectId"`
+	DatabaseID string               `json:"databaseId,omitempty"`
+	Namespace  string               `json:"namespace,omitempty"`
+	Kinds      []exportManifestKind `json:"kinds"`
+}
+
+type exportManifestKind struct {
+	Kind   string `json:"kind"`
+	Filter string `json:"filter,omitempty"`
+	File   string `json:"file"`
+	Count  int    `json:"count"`
+}
+
+func (r *ExportCommand) Run(ctx context.Context, opts command.GlobalOptions) error {
+	queries := make([]*datastore.Query, len(r.Specs))
+	kinds := map[string]bool{}
+	for i, spec := range r.Specs {
+		if kinds[spec.Kind] {
+			return fmt.Errorf("duplicate kind: %s", spec.Kind)
+		}
+		kinds[spec.Kind] = true
+
+		query, err := newFilteredQuery(spec.Kind, r.Namespace, "", spec.Filter)
+		if err != nil {
+			return fmt.Errorf("kind %s: %w", spec.Kind, err)
+		}
+		queries[i] = query
+	}
+
+	client, err := r.DatastoreOptions.CreateClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// read all kinds at the same snapshot
+	readTime, err := r.readTime()
+	if err != nil {
+		return err
+	}
+	if readTime.IsZero() {
+		// a little before now not to be in the future of the server clock
+		readTime = time.Now().Add(-time.Second).Truncate(time.Second)
+	}
+	client = datastore.WithReadTime(client, readTime)
+
+	if err := os.MkdirAll(r.OutputDir, 0o755); err != nil {
+		return err
+	}
+	manifest := exportManifest{
+		ReadTime:   readTime.UTC(),
+		ProjectID:  r.ProjectID,
+		DatabaseID: r.DatabaseID,
+		Namespace:  r.Namespace,
+		Kinds:      make([]exportManifestKind, len(r.Specs)),
+	}
+	for i, spec := range r.Specs {
+		file := exportFileName(spec.Kind)
+		count, err := scanToFile(ctx, client, queries[i], filepath.Join(r.OutputDir, file), func(w io.Writer, encoder *json.Encoder, key *clouddatastore.Key, entity datastore.Entity) error {
+			return encoder.Encode(entity)
+		})
+		if err != nil {
+			return fmt.Errorf("kind %s: %w", spec.Kind, err)
+		}
+		log.Printf("kind %s: %d entities", spec.Kind, count)
+		manifest.Kinds[i] = exportManifestKind{Kind: spec.Kind, Filter: spec.Filter, File: file, Count: count}
+	}
+	return writeExportManifest(filepath.Join(r.OutputDir, exportManifestFile), &manifest)
+}
+
+// exportFileName returns the file name of the kind in the output directory.
+// Kinds may contain /, so they are escaped not to write outside the directory.
+func exportFileName(kind string) string {
+	return url.PathEscape(kind) + ".jsonl"
+}
+
+func writeExportManifest(path string, manifest *exportManifest) error {
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
@@ -0,0 +1,115 @@
+package io
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExportSpecUnmarshalText(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		text    string
+		want    ExportSpec
+		wantErr bool
+	}{
+		{text: "Order", want: ExportSpec{Kind: "Order"}},
+		{text: `LineItem=status = "open"`, want: ExportSpec{Kind: "LineItem", Filter: `status = "open"`}},
+		{text: "LineItem=", want: ExportSpec{Kind: "LineItem"}},
+		{text: "=status = 1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			t.Parallel()
+
+			var got ExportSpec
+			err := got.UnmarshalText([]byte(tt.text))
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected spec (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExportFileName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		kind string
+		want string
+	}{
+		{kind: "Order", want: "Order.jsonl"},
+		{kind: "a/b", want: "a%2Fb.jsonl"},
+		{kind: "../../x", want: "..%2F..%2Fx.jsonl"},
+		{kind: "..", want: "...jsonl"},
+		{kind: "%2F", want: "%252F.jsonl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind, func(t *testing.T) {
+			t.Parallel()
+
+			got := exportFileName(tt.kind)
+			if got != tt.want {
+				t.Errorf("exportFileName(%q) = %q, want %q", tt.kind, got, tt.want)
+			}
+			if filepath.Base(got) != got {
+				t.Errorf("exportFileName(%q) = %q is not a file name", tt.kind, got)
+			}
+		})
+	}
+}
+
+func TestWriteExportManifest(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), exportManifestFile)
+	manifest := &exportManifest{
+		ReadTime:  time.Date(2024, 1, 2, 14, 0, 0, 0, time.UTC),
+		ProjectID: "my-project",
+		Kinds: []exportManifestKind{
+			{Kind: "Order", File: "Order.jsonl", Count: 2},
+			{Kind: "LineItem", Filter: `status = "open"`, File: "LineItem.jsonl", Count: 5},
+		},
+	}
+	if err := writeExportManifest(path, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "readTime": "2024-01-02T14:00:00Z",
+  "projectId": "my-project",
+  "kinds": [
+    {
+      "kind": "Order",
+      "file": "Order.jsonl",
+      "count": 2
+    },
+    {
+      "kind": "LineItem",
+      "filter": "status = \"open\"",
+      "file": "LineItem.jsonl",
+      "count": 5
+    }
+  ]
+}
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("unexpected manifest (-want +got):\n%s", diff)
+	}
+}
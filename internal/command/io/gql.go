@@ -3,6 +3,10 @@ package io
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+
+	clouddatastore "cloud.google.com/go/datastore"
 	"google.golang.org/api/iterator"
 
 	"github.com/karupanerura/dutil/internal/command"
@@ -12,9 +16,14 @@ import (
 
 type GQLCommand struct {
 	DatastoreOptions
-	Query     string `arg:"" name:"query" help:"GQL Query"`
-	Explain   bool   `name:"explain" optional:"" group:"Query" help:"Explain query execution plan"`
-	KeyFormat string `name:"key-format" enum:"json,gql,encoded,proto" default:"json" help:"Key format to output for keys only query"`
+	NamespaceOptions
+	CursorOptions
+	ReadTimeOptions
+	Query     string      `arg:"" name:"query" help:"GQL Query"`
+	Bind      []string    `name:"bind" optional:"" sep:"none" placeholder:"NAME=TYPE:VALUE" group:"Query" help:"Bind the typed value to the binding site @NAME (a positive integer for @1, @2, ...). TYPE is int, float, bool, string, timestamp, key, blob, geo or null. Repeatable. (e.g. --bind=1=int:42 or --bind='owner=key:KEY(User, \"alice\")')"`
+	BindJSON  []string    `name:"bind-json" optional:"" sep:"none" placeholder:"NAME=JSON" group:"Query" help:"Bind the value in JSON representation to the binding site @NAME. Repeatable. (e.g. --bind-json='tags={\"type\":\"array\",\"value\":[{\"type\":\"string\",\"value\":\"a\"}]}')"`
+	Explain   ExplainMode `name:"explain" optional:"" group:"Query" help:"Explain query execution plan. --explain or --explain=analyze executes the query and bills the reads, and --explain=plan only plans it without execution"`
+	KeyFormat string      `name:"key-format" enum:"json,gql,encoded,proto" default:"json" help:"Key format to output for keys only query"`
 }
 
 func (r *GQLCommand) Run(ctx context.Context, opts command.GlobalOptions) error {
@@ -23,19 +32,74 @@ func (r *GQLCommand) Run(ctx context.Context, opts command.GlobalOptions) error
 		return err
 	}
 	defer client.Close()
+	client, err = r.applyReadTime(client)
+	if err != nil {
+		return err
+	}
 
-	qp := &parser.QueryParser{Namespace: r.Namespace}
-	q, keysOnly, aq, err := qp.ParseGQL(r.Query)
+	if r.NamespaceOptions.specified() {
+		switch {
+		case r.CursorOptions.specified():
+			return fmt.Errorf("cursor options cannot be used across namespaces")
+		case r.Explain.enabled():
+			return fmt.Errorf("--explain cannot be used across namespaces")
+		}
+		return r.NamespaceOptions.forEachNamespace(ctx, client, r.Namespace, func(namespace string) error {
+			q := *r
+			q.Namespace = namespace
+			return q.run(ctx, client, opts)
+		})
+	}
+	return r.run(ctx, client, opts)
+}
+
+// run runs the query in the namespace of --namespace option.
+func (r *GQLCommand) run(ctx context.Context, client *datastore.Client, opts command.GlobalOptions) error {
+	bindingParser := &parser.BindingParser{Namespace: r.Namespace}
+	bindings, err := bindingParser.ParseBindings(r.Bind, r.BindJSON)
 	if err != nil {
 		return err
 	}
+
+	qp := &parser.QueryParser{Namespace: r.Namespace, Bindings: bindings}
+	q, keysOnly, aq, err := qp.ParseGQL(r.Query)
+	if errors.Is(err, parser.ErrCountUpToAggregation) {
+		if r.CursorOptions.specified() {
+			return fmt.Errorf("cursor options are not supported for aggregation queries")
+		}
+		llc := datastore.NewLowLevelClient(client)
+		if r.Explain.enabled() {
+			metrics, err := llc.ExplainGQLAggregationQuery(ctx, r.Namespace, r.Query, bindings, r.Explain.options())
+			if err != nil {
+				return err
+			}
+			return json.NewEncoder(opts.Stdout).Encode(metrics)
+		}
+		ar, err := llc.RunGQLAggregationQuery(ctx, r.Namespace, r.Query, bindings)
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(opts.Stdout).Encode(r.tagNamespace(r.Namespace, datastore.NewPropertiesByProtoValueMap(ar)))
+	} else if err != nil {
+		return err
+	}
 	if aq != nil {
+		if r.CursorOptions.specified() {
+			return fmt.Errorf("cursor options are not supported for aggregation queries")
+		}
+		if r.Explain.enabled() {
+			res, err := client.RunAggregationQueryWithOptions(ctx, aq, r.Explain.options())
+			if err != nil {
+				return err
+			}
+			return json.NewEncoder(opts.Stdout).Encode(res.ExplainMetrics)
+		}
 		ar, err := client.RunAggregationQuery(ctx, aq)
 		if err != nil {
 			return err
 		}
 
-		props := datastore.NewPropertiesByProtoValueMap(ar)
+		props := r.tagNamespace(r.Namespace, datastore.NewPropertiesByProtoValueMap(ar))
 		err = json.NewEncoder(opts.Stdout).Encode(props)
 		if err != nil {
 			return err
@@ -43,14 +107,14 @@ func (r *GQLCommand) Run(ctx context.Context, opts command.GlobalOptions) error
 		return nil
 	}
 
-	options := []datastore.RunOption{}
-	if r.Explain {
-		options = append(options, datastore.ExplainOptions{Analyze: true})
+	q, err = r.applyCursors(q)
+	if err != nil {
+		return err
 	}
 
-	iter := client.RunWithOptions(ctx, q, options...)
-	if r.Explain {
+	if r.Explain.enabled() {
 		// read all
+		iter := client.RunWithOptions(ctx, q, r.Explain.options())
 		for {
 			if _, err := iter.Next(nil); err == iterator.Done {
 				return json.NewEncoder(opts.Stdout).Encode(iter.ExplainMetrics)
@@ -62,18 +126,11 @@ func (r *GQLCommand) Run(ctx context.Context, opts command.GlobalOptions) error
 
 	keyFormatter := datastore.KeyFormatter{Format: r.KeyFormat}
 	encoder := json.NewEncoder(opts.Stdout)
-	for {
-		var entity datastore.Entity
-		key, err := iter.Next(&entity)
-		if err == iterator.Done {
-			break
-		} else if err != nil {
-			return err
-		}
-
-		if err := writeQueryResult(opts.Stdout, encoder, keyFormatter, key, entity, keysOnly); err != nil {
-			return err
-		}
+	cursor, err := newQueryScanner(ctx, client).scan(ctx, q, func(key *clouddatastore.Key, entity datastore.Entity) error {
+		return writeQueryResult(opts.Stdout, encoder, keyFormatter, key, entity, keysOnly)
+	})
+	if err != nil {
+		return err
 	}
-	return nil
+	return r.emitCursor(opts.Stdout, opts.Stderr, cursor)
 }
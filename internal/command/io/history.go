@@ -0,0 +1,167 @@
+package io
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/karupanerura/dutil/internal/command"
+	"github.com/karupanerura/dutil/internal/datastore"
+	"github.com/karupanerura/dutil/internal/parser"
+)
+
+// pitrMinuteGranularityAge is the age of the read time since which PITR reads must be whole minutes.
+const pitrMinuteGranularityAge = time.Hour
+
+type HistoryCommand struct {
+	DatastoreOptions
+	ReadTimeOptions
+	Keys      []string      `arg:"" name:"keys" help:"Keys to reconstruct the version history (format: https://support.google.com/cloud/answer/6361641)"`
+	Retention time.Duration `name:"retention" default:"168h" help:"Retention period of point-in-time recovery to walk back (7 days if PITR is enabled, otherwise 1 hour)"`
+	Limit     int           `name:"limit" optional:"" help:"Maximum number of versions per key (default: unlimited)"`
+}
+
+// historyRecord is a version of the entity in the timeline.
+type historyRecord struct {
+	Key *datastore.Key `json:"key"`
+
+	// Status is created if the entity did not exist before the version, updated if the previous version is found,
+	// or unknown if the previous version is out of the retention period or the limit.
+	Status string `json:"status"`
+
+	// Entity is the entity of the version with its metadata.
+	Entity *datastore.Entity `json:"entity"`
+
+	// Diff is the differences from the previous version. All properties are added for a created version.
+	Diff []datastore.PropertyDiff `json:"diff,omitempty"`
+}
+
+func (r *HistoryCommand) Run(ctx context.Context, opts command.GlobalOptions) error {
+	if r.Retention <= 0 {
+		return fmt.Errorf("--retention must be positive")
+	}
+
+	keyParser := &parser.KeyParser{Namespace: r.Namespace}
+	keys, err := keyParser.ParseKeys(r.Keys)
+	if err != nil {
+		return fmt.Errorf("keyParser.ParseKeys: %w", err)
+	}
+
+	client, err := r.DatastoreOptions.CreateClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	client, err = r.applyReadTime(client)
+	if err != nil {
+		return err
+	}
+
+	since := time.Now().Add(-r.Retention)
+	llc := datastore.NewLowLevelClient(client)
+	encoder := json.NewEncoder(opts.Stdout)
+	for _, key := range keys {
+		lookup := func(readTime time.Time) (*datastore.Entity, error) {
+			llc := llc
+			if !readTime.IsZero() {
+				llc = llc.WithReadTime(readTime)
+			}
+			return llc.Lookup(ctx, key.ToDatastore())
+		}
+		versions, created, err := r.walkHistory(key, lookup, since)
+		if err != nil {
+			return fmt.Errorf("key=%s: %w", key.String(), err)
+		}
+		if len(versions) == 0 {
+			log.Printf("key=%s is not found (try --read-time before the deletion)", key.String())
+			continue
+		}
+		for _, record := range newHistoryRecords(key, versions, created) {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// walkHistory looks up the versions of the entity backward from the latest (or --read-time) one to the time since.
+// lookup looks up the entity at the read time, or at the latest (or --read-time) one for zero time.
+// The versions are newest first, and created reports whether the entity did not exist before the oldest version.
+func (r *HistoryCommand) walkHistory(key *datastore.Key, lookup func(readTime time.Time) (*datastore.Entity, error), since time.Time) (versions []*datastore.Entity, created bool, err error) {
+	var readTime time.Time
+	for r.Limit == 0 || len(versions) < r.Limit {
+		entity, err := lookup(readTime)
+		if err != nil && len(versions) != 0 && isOutOfRetentionError(err) {
+			// --retention is longer than the PITR window of the database, so the older versions are unknown
+			log.Printf("key=%s: stopped at the read time %s out of the retention period: %v", key.String(), readTime.Format(time.RFC3339Nano), err)
+			return versions, false, nil
+		} else if err != nil {
+			return nil, false, fmt.Errorf("llc.Lookup: %w", err)
+		}
+		if entity == nil {
+			return versions, len(versions) != 0, nil
+		}
+		if len(versions) != 0 && !entity.Metadata.UpdateTime.Before(versions[len(versions)-1].Metadata.UpdateTime) {
+			return nil, false, fmt.Errorf("version=%d is not older than the next version", entity.Metadata.Version)
+		}
+		versions = append(versions, entity)
+
+		if !entity.Metadata.UpdateTime.After(entity.Metadata.CreateTime) {
+			// the first version since the creation
+			return versions, true, nil
+		}
+		readTime = previousReadTime(entity.Metadata.UpdateTime, time.Now())
+		if readTime.Before(since) {
+			return versions, false, nil
+		}
+	}
+	return versions, false, nil
+}
+
+// isOutOfRetentionError reports whether the lookup is rejected because the read time is older than the PITR window.
+func isOutOfRetentionError(err error) bool {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.FailedPrecondition:
+		return true
+	default:
+		return false
+	}
+}
+
+// previousReadTime returns the latest read time before the update time. PITR reads older than 1 hour must be
+// whole minutes, so the versions updated in the same minute before the update time cannot be found.
+func previousReadTime(updateTime, now time.Time) time.Time {
+	// datastore timestamps are microseconds precision
+	readTime := updateTime.Add(-time.Microsecond)
+	// with a minute margin for the time to look up
+	if readTime.Before(now.Add(-pitrMinuteGranularityAge + time.Minute)) {
+		readTime = readTime.Truncate(time.Minute)
+	}
+	return readTime
+}
+
+// newHistoryRecords creates the timeline of the versions (newest first) in chronological order.
+func newHistoryRecords(key *datastore.Key, versions []*datastore.Entity, created bool) []historyRecord {
+	records := make([]historyRecord, len(versions))
+	for i, entity := range slices.Backward(versions) {
+		record := historyRecord{Key: key, Status: "updated", Entity: entity}
+		switch {
+		case i+1 < len(versions):
+			record.Diff = datastore.DiffProperties(versions[i+1].Properties, entity.Properties)
+		case created:
+			record.Status = "created"
+			record.Diff = datastore.DiffProperties(nil, entity.Properties)
+		default:
+			record.Status = "unknown"
+		}
+		records[len(versions)-1-i] = record
+	}
+	return records
+}
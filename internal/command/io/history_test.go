@@ -0,0 +1,172 @@
+package io
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+func TestPreviousReadTime(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		updateTime time.Time
+		want       time.Time
+	}{
+		{
+			name:       "recent",
+			updateTime: time.Date(2024, 1, 2, 14, 30, 10, 500, time.UTC),
+			want:       time.Date(2024, 1, 2, 14, 30, 10, 500, time.UTC).Add(-time.Microsecond),
+		},
+		{
+			name:       "older than 1 hour",
+			updateTime: time.Date(2024, 1, 2, 13, 30, 10, 0, time.UTC),
+			want:       time.Date(2024, 1, 2, 13, 30, 0, 0, time.UTC),
+		},
+		{
+			name:       "whole minute",
+			updateTime: time.Date(2024, 1, 2, 13, 30, 0, 0, time.UTC),
+			want:       time.Date(2024, 1, 2, 13, 29, 0, 0, time.UTC),
+		},
+		{
+			name:       "margin",
+			updateTime: time.Date(2024, 1, 2, 14, 0, 30, 0, time.UTC),
+			want:       time.Date(2024, 1, 2, 14, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := previousReadTime(tt.updateTime, now); !got.Equal(tt.want) {
+				t.Errorf("unexpected read time: %v", got)
+			}
+		})
+	}
+}
+
+func TestNewHistoryRecords(t *testing.T) {
+	t.Parallel()
+
+	key := &datastore.Key{Kind: "Task", Name: "foo"}
+	newVersion := func(version int64, value int64) *datastore.Entity {
+		return &datastore.Entity{
+			Key:        key,
+			Properties: []datastore.Property{{Name: "value", Value: datastore.Value{Type: datastore.IntType, Value: value}}},
+			Metadata:   &datastore.EntityMetadata{Version: version},
+		}
+	}
+	v1, v2, v3 := newVersion(1, 10), newVersion(2, 20), newVersion(3, 20)
+	versions := []*datastore.Entity{v3, v2, v1}
+
+	t.Run("created", func(t *testing.T) {
+		t.Parallel()
+
+		got := newHistoryRecords(key, versions, true)
+		want := []historyRecord{
+			{Key: key, Status: "created", Entity: v1, Diff: []datastore.PropertyDiff{{Name: "value", After: &v1.Properties[0]}}},
+			{Key: key, Status: "updated", Entity: v2, Diff: []datastore.PropertyDiff{{Name: "value", Before: &v1.Properties[0], After: &v2.Properties[0]}}},
+			{Key: key, Status: "updated", Entity: v3},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("unexpected records (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		t.Parallel()
+
+		got := newHistoryRecords(key, versions[:2], false)
+		want := []historyRecord{
+			{Key: key, Status: "unknown", Entity: v2},
+			{Key: key, Status: "updated", Entity: v3},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("unexpected records (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestHistoryCommandWalkHistory(t *testing.T) {
+	t.Parallel()
+
+	key := &datastore.Key{Kind: "Task", Name: "foo"}
+	now := time.Now()
+	created := now.Add(-3 * time.Hour)
+	newVersion := func(version int64, age time.Duration) *datastore.Entity {
+		return &datastore.Entity{Key: key, Metadata: &datastore.EntityMetadata{Version: version, CreateTime: created, UpdateTime: now.Add(-age)}}
+	}
+	v1 := &datastore.Entity{Key: key, Metadata: &datastore.EntityMetadata{Version: 1, CreateTime: created, UpdateTime: created}}
+	v2, v3 := newVersion(2, 2*time.Hour), newVersion(3, time.Minute)
+	outOfRetention := status.Error(codes.FailedPrecondition, "read time is out of the retention period")
+
+	// each lookup returns the result
+	type result struct {
+		entity *datastore.Entity
+		err    error
+	}
+	tests := []struct {
+		name        string
+		results     []result
+		want        []*datastore.Entity
+		wantCreated bool
+		wantErr     bool
+	}{
+		{
+			name:        "created",
+			results:     []result{{entity: v3}, {entity: v2}, {entity: v1}},
+			want:        []*datastore.Entity{v3, v2, v1},
+			wantCreated: true,
+		},
+		{
+			name:    "out of retention",
+			results: []result{{entity: v3}, {entity: v2}, {err: outOfRetention}},
+			want:    []*datastore.Entity{v3, v2},
+		},
+		{
+			name:    "out of retention at the first lookup",
+			results: []result{{err: outOfRetention}},
+			wantErr: true,
+		},
+		{
+			name:    "other error",
+			results: []result{{entity: v3}, {err: status.Error(codes.PermissionDenied, "denied")}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var lookups int
+			lookup := func(readTime time.Time) (*datastore.Entity, error) {
+				r := tt.results[lookups]
+				lookups++
+				return r.entity, r.err
+			}
+			r := &HistoryCommand{}
+			got, gotCreated, err := r.walkHistory(key, lookup, now.Add(-168*time.Hour))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error but got %d versions", len(got))
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected versions (-want +got):\n%s", diff)
+			}
+			if gotCreated != tt.wantCreated {
+				t.Errorf("created = %v, want %v", gotCreated, tt.wantCreated)
+			}
+		})
+	}
+}
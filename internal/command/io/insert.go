@@ -4,17 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"slices"
+	"sync"
+
 	"github.com/karupanerura/dutil/internal/command"
 	"github.com/karupanerura/dutil/internal/datastore"
-	"io"
-	"log"
 )
 
 type InsertCommand struct {
 	DatastoreOptions
-	Force  bool `name:"force" short:"f" optional:"" env:"DATASTORE_CLI_FORCE_INSERT" help:"Force insert without confirmation"`
-	Commit bool `name:"commit" short:"c" optional:"" help:"Commit transaction without confirmation"`
-	Silent bool `name:"silent" short:"s" optional:"" help:"Silent mode"`
+	BatchOptions
+	Force        bool   `name:"force" short:"f" optional:"" env:"DATASTORE_CLI_FORCE_INSERT" help:"Force insert without confirmation"`
+	Commit       bool   `name:"commit" short:"c" optional:"" help:"Commit transaction without confirmation"`
+	Silent       bool   `name:"silent" short:"s" optional:"" help:"Silent mode"`
+	DryRun       bool   `name:"dry-run" optional:"" help:"Show differences from the current entities without committing"`
+	KeyFormat    string `name:"key-format" enum:"json,gql,encoded,proto" default:"json" help:"Key format to output the completed keys of incomplete keys"`
+	GenerateName string `name:"generate-name" enum:",uuid,ulid" default:"" placeholder:"uuid|ulid" help:"Complete incomplete keys with generated names (uuid or ulid) instead of allocated IDs"`
 }
 
 func (r *InsertCommand) Run(ctx context.Context, opts command.GlobalOptions) error {
@@ -24,45 +30,121 @@ func (r *InsertCommand) Run(ctx context.Context, opts command.GlobalOptions) err
 	}
 	defer client.Close()
 
-	var keys datastore.Keys
-	var mutations []*datastore.Mutation
-	decoder := json.NewDecoder(opts.Stdin)
-	for {
-		var entity *datastore.Entity
-		if err := decoder.Decode(&entity); err == io.EOF {
-			break
-		} else if err != nil {
+	entities := newEntitySource(opts.Stdin, func(entity *datastore.Entity) *datastore.Mutation {
+		return datastore.NewInsert(entity.Key.ToDatastore(), entity)
+	})
+	var source mutationSource = entities
+	if r.Checkpoint != "" {
+		source = &completeKeySource{entitySource: entities}
+	}
+	runner := &mutationRunner{
+		client:         client,
+		batchSize:      r.BatchSize,
+		parallelism:    r.Parallelism,
+		expectCount:    r.ExpectCount,
+		checkpoint:     r.Checkpoint,
+		silent:         r.Silent,
+		force:          r.Force,
+		dryRun:         r.DryRun,
+		stdout:         opts.Stdout,
+		askCommit:      !r.Force && !r.Commit,
+		operation:      "insert",
+		confirmMessage: "Insert these entities?",
+	}
+
+	var generateName func() string
+	if r.GenerateName != "" {
+		generateName = newNameGenerator(r.GenerateName)
+	}
+
+	var mu sync.Mutex
+	encoder := json.NewEncoder(opts.Stdout)
+	keyFormatter := datastore.KeyFormatter{Format: r.KeyFormat}
+	runner.commitFunc = func(ctx context.Context, batch mutationBatch) error {
+		completed, err := completeKeys(ctx, client, &batch, generateName)
+		if err != nil {
+			return err
+		}
+		if err := runner.commitInTransaction(ctx, batch); err != nil {
 			return err
 		}
-		keys = append(keys, entity.Key)
-		mutations = append(mutations, datastore.NewInsert(entity.Key.ToDatastore(), entity))
+
+		mu.Lock()
+		defer mu.Unlock()
+		return writeCompletedKeys(opts.Stdout, encoder, keyFormatter, batch, completed)
 	}
+	return runner.run(ctx, source)
+}
 
-	// pre confirmation
-	if !r.Silent {
-		log.Printf("%d keys to insert:", len(keys))
-		for _, key := range keys {
-			log.Println(key.String())
+// writeCompletedKeys writes the keys of the batch at the indexes returned by completeKeys in order.
+func writeCompletedKeys(stdout io.Writer, encoder *json.Encoder, keyFormatter datastore.KeyFormatter, batch mutationBatch, indexes []int) error {
+	for _, i := range indexes {
+		if err := writeKey(stdout, encoder, keyFormatter, batch.keys[i]); err != nil {
+			return err
 		}
 	}
-	if !r.Force && !confirm("Insert these entities?") {
-		return fmt.Errorf("aborted")
+	return nil
+}
+
+// completeKeySource is an entitySource which rejects incomplete keys for --checkpoint.
+// The keys completed in a batch interrupted before being recorded are not known on resume,
+// so the batch would be inserted again as duplicated entities with new keys.
+type completeKeySource struct {
+	*entitySource
+}
+
+func (s *completeKeySource) Next() (mutationEntry, error) {
+	entry, err := s.entitySource.Next()
+	if err != nil {
+		return mutationEntry{}, err
+	}
+	if entry.key.Incomplete() {
+		return mutationEntry{}, fmt.Errorf("--checkpoint cannot be used for incomplete keys because interrupted batches would be inserted twice with new keys: %s", keyLabel(entry.key))
 	}
+	return entry, nil
+}
 
-	if _, err = client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
-		if _, err := tx.Mutate(mutations...); err != nil {
-			return fmt.Errorf("client.Mutate: %w", err)
+// completeKeys completes the incomplete keys in the batch with generated names (if generateName is given)
+// or allocated IDs, and returns the indexes of the completed keys.
+func completeKeys(ctx context.Context, client *datastore.Client, batch *mutationBatch, generateName func() string) ([]int, error) {
+	var indexes []int
+	for i, key := range batch.keys {
+		if key.Incomplete() {
+			indexes = append(indexes, i)
 		}
+	}
+	if len(indexes) == 0 {
+		return nil, nil
+	}
 
-		// post confirmation
-		if !r.Force && !r.Commit && !confirm("Commit?") {
-			return fmt.Errorf("aborted")
+	completed := make(datastore.Keys, 0, len(indexes))
+	if generateName != nil {
+		for _, i := range indexes {
+			key := *batch.keys[i]
+			key.Name = generateName()
+			completed = append(completed, &key)
+		}
+	} else {
+		for chunk := range slices.Chunk(indexes, maxCommitMutations) {
+			keys := make(datastore.Keys, len(chunk))
+			for j, i := range chunk {
+				keys[j] = batch.keys[i]
+			}
+			allocated, err := client.AllocateIDs(ctx, keys.ToDatastore())
+			if err != nil {
+				return nil, fmt.Errorf("client.AllocateIDs: %w", err)
+			}
+			for _, key := range allocated {
+				completed = append(completed, datastore.FromDatastoreKey(key))
+			}
 		}
-
-		return nil
-	}); err != nil {
-		return fmt.Errorf("client.RunInTransaction: %w", err)
 	}
 
-	return nil
+	for j, i := range indexes {
+		entity := batch.entities[i]
+		entity.Key = completed[j]
+		batch.keys[i] = completed[j]
+		batch.mutations[i] = datastore.NewInsert(entity.Key.ToDatastore(), entity)
+	}
+	return indexes, nil
 }
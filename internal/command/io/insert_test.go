@@ -0,0 +1,128 @@
+package io
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+func TestCompleteKeySource(t *testing.T) {
+	t.Parallel()
+
+	input := `{"key":{"kind":"Task","id":1},"properties":[]}
+{"key":{"kind":"Task"},"properties":[]}
+`
+	source := &completeKeySource{entitySource: newEntitySource(strings.NewReader(input), func(entity *datastore.Entity) *datastore.Mutation {
+		return datastore.NewInsert(entity.Key.ToDatastore(), entity)
+	})}
+	if _, ok := any(source).(rewindableSource); !ok {
+		t.Error("completeKeySource should be rewindable for the confirmation")
+	}
+
+	entry, err := source.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.key.ID != 1 {
+		t.Errorf("unexpected key: %s", entry.key.String())
+	}
+	if _, err := source.Next(); err == nil {
+		t.Error("expected an error for the incomplete key")
+	}
+}
+
+func TestCompleteKeys_GenerateName(t *testing.T) {
+	t.Parallel()
+
+	parent := &datastore.Key{Kind: "User", Name: "alice"}
+	tests := []struct {
+		name        string
+		keys        datastore.Keys
+		wantKeys    datastore.Keys
+		wantIndexes []int
+		wantOutput  string
+	}{
+		{
+			name: "mixed",
+			keys: datastore.Keys{
+				{Kind: "Task", ID: 1},
+				{Kind: "Task"},
+				{Kind: "Task", Name: "foo"},
+				{Kind: "Task", Parent: parent},
+			},
+			wantKeys: datastore.Keys{
+				{Kind: "Task", ID: 1},
+				{Kind: "Task", Name: "name-1"},
+				{Kind: "Task", Name: "foo"},
+				{Kind: "Task", Name: "name-2", Parent: parent},
+			},
+			wantIndexes: []int{1, 3},
+			wantOutput:  "KEY(Task,\"name-1\")\nKEY(User,\"alice\",Task,\"name-2\")\n",
+		},
+		{
+			name:     "complete",
+			keys:     datastore.Keys{{Kind: "Task", ID: 1}, {Kind: "Task", Name: "foo"}},
+			wantKeys: datastore.Keys{{Kind: "Task", ID: 1}, {Kind: "Task", Name: "foo"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var batch mutationBatch
+			for _, key := range tt.keys {
+				entity := &datastore.Entity{Key: key}
+				batch.add(mutationEntry{key: key, entity: entity, mutation: datastore.NewInsert(key.ToDatastore(), entity)})
+			}
+			input := slices.Clone(batch.keys)
+
+			var n int
+			generateName := func() string {
+				n++
+				return "name-" + strconv.Itoa(n)
+			}
+			indexes, err := completeKeys(t.Context(), nil, &batch, generateName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.wantIndexes, indexes); diff != "" {
+				t.Errorf("unexpected indexes (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantKeys, batch.keys); diff != "" {
+				t.Errorf("unexpected keys (-want +got):\n%s", diff)
+			}
+
+			var output strings.Builder
+			if err := writeCompletedKeys(&output, json.NewEncoder(&output), datastore.KeyFormatter{Format: "gql"}, batch, indexes); err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.wantOutput, output.String()); diff != "" {
+				t.Errorf("unexpected output (-want +got):\n%s", diff)
+			}
+			for i, key := range batch.keys {
+				completed := slices.Contains(indexes, i)
+				if completed != input[i].Incomplete() {
+					t.Errorf("key %d: completed = %v, but the input key is %s", i, completed, keyLabel(input[i]))
+				}
+				if !completed && key != input[i] {
+					t.Errorf("complete key %d is rewritten: %s", i, key.String())
+				}
+				if batch.entities[i].Key != key {
+					t.Errorf("entity key %d is %s, want %s", i, batch.entities[i].Key.String(), key.String())
+				}
+				want := datastore.NewInsert(key.ToDatastore(), batch.entities[i])
+				if diff := cmp.Diff(want, batch.mutations[i], cmp.AllowUnexported(datastore.Mutation{}), protocmp.Transform()); diff != "" {
+					t.Errorf("unexpected mutation %d (-want +got):\n%s", i, diff)
+				}
+			}
+
+		})
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"slices"
+
 	"github.com/karupanerura/dutil/internal/command"
 	"github.com/karupanerura/dutil/internal/datastore"
 	"github.com/karupanerura/dutil/internal/parser"
@@ -12,7 +15,9 @@ import (
 
 type LookupCommand struct {
 	DatastoreOptions
-	Keys         []string `arg:"" name:"keys" help:"Keys to lookup (format: https://support.google.com/cloud/answer/6361641)"`
+	NamespaceOptions
+	ReadTimeOptions
+	Keys         []string `arg:"" name:"keys" optional:"" help:"Keys to lookup (format: https://support.google.com/cloud/answer/6361641). If omitted, keys are read from stdin in any key format or entity JSON Lines"`
 	WithMetadata bool     `name:"with-metadata" help:"Lookup with internal metadata in datastore (EXPERIMENTAL)"`
 }
 
@@ -22,43 +27,130 @@ func (r *LookupCommand) Run(ctx context.Context, opts command.GlobalOptions) err
 		return err
 	}
 	defer client.Close()
+	client, err = r.applyReadTime(client)
+	if err != nil {
+		return err
+	}
+
+	lookup := r.lookup
+	if r.NamespaceOptions.specified() {
+		namespaces, err := r.NamespaceOptions.namespaces(ctx, client, r.Namespace)
+		if err != nil {
+			return err
+		}
+		lookup = func(ctx context.Context, client *datastore.Client, encoder *json.Encoder, keys datastore.Keys) error {
+			return r.lookupNamespaces(ctx, client, encoder, keys, namespaces)
+		}
+	}
 
 	keyParser := &parser.KeyParser{Namespace: r.Namespace}
-	keys, err := keyParser.ParseKeys(r.Keys)
-	if err != nil {
-		return fmt.Errorf("keyParser.ParseKeys: %w", err)
+	encoder := json.NewEncoder(opts.Stdout)
+	if len(r.Keys) != 0 {
+		keys, err := keyParser.ParseKeys(r.Keys)
+		if err != nil {
+			return fmt.Errorf("keyParser.ParseKeys: %w", err)
+		}
+		for chunk := range slices.Chunk(keys, maxLookupKeys) {
+			if err := lookup(ctx, client, encoder, chunk); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
-	entities := make([]*datastore.Entity, len(keys))
-	if err := client.GetMulti(ctx, keys.ToDatastore(), entities); err != nil {
-		var mErr datastore.MultiError
-		if errors.As(err, &mErr) {
-			for _, err := range mErr {
-				if err != nil && !errors.Is(err, datastore.ErrNoSuchEntity) {
-					return mErr
-				}
+	keyReader, err := parser.NewKeyReader("auto", opts.Stdin, keyParser)
+	if errors.Is(err, io.EOF) {
+		// empty input
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	keys := make(datastore.Keys, 0, maxLookupKeys)
+	for {
+		key, err := keyReader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		keys = append(keys, key)
+		if len(keys) == maxLookupKeys {
+			if err := lookup(ctx, client, encoder, keys); err != nil {
+				return err
 			}
-		} else {
+			keys = keys[:0]
+		}
+	}
+	if len(keys) != 0 {
+		return lookup(ctx, client, encoder, keys)
+	}
+	return nil
+}
+
+func (r *LookupCommand) lookup(ctx context.Context, client *datastore.Client, encoder *json.Encoder, keys datastore.Keys) error {
+	entities := make([]*datastore.Entity, len(keys))
+	if err := getMulti(ctx, client, keys, entities); err != nil {
+		return err
+	}
+	if err := r.lookupMetadata(ctx, client, keys, entities); err != nil {
+		return err
+	}
+
+	for _, entity := range entities {
+		if err := encoder.Encode(entity); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	if r.WithMetadata {
-		llc := datastore.NewLowLevelClient(client)
+// lookupNamespaces looks up the keys in each namespace, and writes only the found entities
+// because null records cannot tell the namespaces.
+func (r *LookupCommand) lookupNamespaces(ctx context.Context, client *datastore.Client, encoder *json.Encoder, keys datastore.Keys, namespaces []string) error {
+	for _, namespace := range namespaces {
+		nsKeys := make(datastore.Keys, len(keys))
 		for i, key := range keys {
-			meta, err := llc.GetMetadata(ctx, key.ToDatastore())
-			if err != nil {
+			nsKeys[i] = key.WithNamespace(namespace)
+		}
+
+		entities := make([]*datastore.Entity, len(nsKeys))
+		if err := getMulti(ctx, client, nsKeys, entities); err != nil {
+			return fmt.Errorf("namespace %q: %w", namespace, err)
+		}
+		if err := r.lookupMetadata(ctx, client, nsKeys, entities); err != nil {
+			return fmt.Errorf("namespace %q: %w", namespace, err)
+		}
+
+		for _, entity := range entities {
+			if entity == nil {
+				continue
+			}
+			if err := encoder.Encode(entity); err != nil {
 				return err
 			}
-			entities[i].Metadata = meta
 		}
 	}
+	return nil
+}
 
-	encoder := json.NewEncoder(opts.Stdout)
-	for _, entity := range entities {
-		if err := encoder.Encode(entity); err != nil {
+// lookupMetadata sets the metadata of the found entities if --with-metadata is specified.
+func (r *LookupCommand) lookupMetadata(ctx context.Context, client *datastore.Client, keys datastore.Keys, entities []*datastore.Entity) error {
+	if !r.WithMetadata {
+		return nil
+	}
+
+	llc := datastore.NewLowLevelClient(client)
+	for i, key := range keys {
+		if entities[i] == nil {
+			continue
+		}
+		meta, err := llc.GetMetadata(ctx, key.ToDatastore())
+		if err != nil {
 			return err
 		}
+		entities[i].Metadata = meta
 	}
 	return nil
 }
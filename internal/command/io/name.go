@@ -0,0 +1,67 @@
+package io
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// newNameGenerator returns a function generating unique key names in the format (uuid or ulid).
+func newNameGenerator(format string) func() string {
+	switch format {
+	case "uuid":
+		return newUUID
+	case "ulid":
+		return func() string {
+			return newULID(time.Now())
+		}
+	default:
+		panic("unknown name format: " + format)
+	}
+}
+
+// newUUID generates a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant 10
+
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+	return string(s[:])
+}
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID generates a ULID (https://github.com/ulid/spec) of the time with random bits.
+func newULID(t time.Time) string {
+	var b [16]byte
+	ms := uint64(t.UnixMilli())
+	if ms >= 1<<48 {
+		panic(fmt.Sprintf("time is too large for ULID: %s", t))
+	}
+	binary.BigEndian.PutUint64(b[0:8], ms<<16)
+	_, _ = rand.Read(b[6:])
+
+	// encode 128 bits into 26 characters of 5 bits from the most significant bits (the first character has 3 bits)
+	hi := binary.BigEndian.Uint64(b[0:8])
+	lo := binary.BigEndian.Uint64(b[8:16])
+	var s [26]byte
+	for i := len(s) - 1; i >= 0; i-- {
+		s[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:])
+}
@@ -0,0 +1,38 @@
+package io
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestNewUUID(t *testing.T) {
+	t.Parallel()
+
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a, b := newUUID(), newUUID()
+	if !pattern.MatchString(a) {
+		t.Errorf("invalid UUID: %s", a)
+	}
+	if a == b {
+		t.Errorf("duplicate UUID: %s", a)
+	}
+}
+
+func TestNewULID(t *testing.T) {
+	t.Parallel()
+
+	pattern := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+	at := time.UnixMilli(1469918176385)
+	got := newULID(at)
+	if !pattern.MatchString(got) {
+		t.Errorf("invalid ULID: %s", got)
+	}
+	// example of the spec: 01ARYZ6S41TSV4RRFFQ69G5FAV
+	if want := "01ARYZ6S41"; got[:10] != want {
+		t.Errorf("timestamp = %s, want %s", got[:10], want)
+	}
+	if later := newULID(at.Add(time.Millisecond)); later <= got {
+		t.Errorf("ULID is not sortable: %s <= %s", later, got)
+	}
+}
@@ -0,0 +1,95 @@
+package io
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+// namespaceProperty is the name of the property to tag aggregation results with the namespace.
+const namespaceProperty = "__namespace__"
+
+type NamespaceOptions struct {
+	// AllNamespaces runs the command in all namespaces
+	AllNamespaces bool `name:"all-namespaces" optional:"" group:"Namespace" help:"Run in all namespaces enumerated by __namespace__ kind including the default namespace"`
+
+	// NamespacePattern runs the command in the namespaces matching the pattern
+	NamespacePattern string `name:"namespace-pattern" optional:"" placeholder:"GLOB" group:"Namespace" help:"Run in the namespaces matching the glob pattern enumerated by __namespace__ kind (e.g. 'tenant-*')"`
+}
+
+func (o *NamespaceOptions) specified() bool {
+	return o.AllNamespaces || o.NamespacePattern != ""
+}
+
+// forEachNamespace calls fn for each namespace in order. namespace is the value of --namespace option.
+func (o *NamespaceOptions) forEachNamespace(ctx context.Context, client *datastore.Client, namespace string, fn func(namespace string) error) error {
+	namespaces, err := o.namespaces(ctx, client, namespace)
+	if err != nil {
+		return err
+	}
+	for _, ns := range namespaces {
+		if err := fn(ns); err != nil {
+			return fmt.Errorf("namespace %q: %w", ns, err)
+		}
+	}
+	return nil
+}
+
+// namespaces returns the namespaces to run the command in. namespace is the value of --namespace option.
+func (o *NamespaceOptions) namespaces(ctx context.Context, client *datastore.Client, namespace string) ([]string, error) {
+	switch {
+	case o.AllNamespaces && o.NamespacePattern != "":
+		return nil, fmt.Errorf("--all-namespaces and --namespace-pattern are exclusive")
+	case namespace != "":
+		return nil, fmt.Errorf("--namespace cannot be used with --all-namespaces and --namespace-pattern")
+	}
+	if _, err := path.Match(o.NamespacePattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid --namespace-pattern: %w", err)
+	}
+
+	namespaces, err := listNamespaces(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	return matchNamespaces(namespaces, o.NamespacePattern), nil
+}
+
+// matchNamespaces returns the namespaces matching the valid glob pattern. An empty pattern matches all namespaces.
+func matchNamespaces(namespaces []string, pattern string) []string {
+	if pattern == "" {
+		return namespaces
+	}
+	return slices.DeleteFunc(slices.Clone(namespaces), func(ns string) bool {
+		ok, _ := path.Match(pattern, ns)
+		return !ok
+	})
+}
+
+// tagNamespace prepends the namespace property to the aggregation result if the command runs in multiple namespaces.
+func (o *NamespaceOptions) tagNamespace(namespace string, props []datastore.Property) []datastore.Property {
+	if !o.specified() {
+		return props
+	}
+	return slices.Insert(props, 0, datastore.Property{
+		Name:  namespaceProperty,
+		Value: datastore.Value{Type: datastore.StringType, Value: namespace},
+	})
+}
+
+// listNamespaces returns the namespaces by __namespace__ kind. The default namespace is an empty string.
+func listNamespaces(ctx context.Context, client *datastore.Client) ([]string, error) {
+	keys, err := client.GetAll(ctx, datastore.NewQuery("__namespace__").KeysOnly(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("client.GetAll: %w", err)
+	}
+
+	namespaces := make([]string, len(keys))
+	for i, key := range keys {
+		// the default namespace is represented by the numeric ID 1
+		namespaces[i] = key.Name
+	}
+	return namespaces, nil
+}
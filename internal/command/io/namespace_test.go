@@ -0,0 +1,32 @@
+package io
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMatchNamespaces(t *testing.T) {
+	t.Parallel()
+
+	namespaces := []string{"", "tenant-a", "tenant-b", "test"}
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{pattern: "", want: []string{"", "tenant-a", "tenant-b", "test"}},
+		{pattern: "*", want: []string{"", "tenant-a", "tenant-b", "test"}},
+		{pattern: "tenant-*", want: []string{"tenant-a", "tenant-b"}},
+		{pattern: "te?t", want: []string{"test"}},
+		{pattern: "other", want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(tt.want, matchNamespaces(namespaces, tt.pattern)); diff != "" {
+				t.Errorf("unexpected namespaces (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
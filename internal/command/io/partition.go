@@ -0,0 +1,161 @@
+package io
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+
+	clouddatastore "cloud.google.com/go/datastore"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+// scatterOversampling is the number of sampled keys per partition to choose the split keys.
+const scatterOversampling = 32
+
+// sampleSplitKeys samples keys of the kind ordered by the __scatter__ property, which is a random value
+// Datastore assigns to a part of the entities, and returns at most n-1 keys to split the key space into n ranges.
+func sampleSplitKeys(ctx context.Context, client *datastore.Client, kind, namespace string, n int) (datastore.Keys, error) {
+	query := datastore.NewQuery(kind).Order("__scatter__").KeysOnly().Limit((n - 1) * scatterOversampling)
+	if namespace != "" {
+		query = query.Namespace(namespace)
+	}
+	dsKeys, err := client.GetAll(ctx, query, nil)
+	if err != nil {
+		return nil, fmt.Errorf("client.GetAll: %w", err)
+	}
+
+	samples := make(datastore.Keys, len(dsKeys))
+	for i, key := range dsKeys {
+		samples[i] = datastore.FromDatastoreKey(key)
+	}
+	return chooseSplitKeys(samples, n), nil
+}
+
+// chooseSplitKeys chooses at most n-1 keys evenly from the samples in key order.
+func chooseSplitKeys(samples datastore.Keys, n int) datastore.Keys {
+	samples = slices.Clone(samples)
+	slices.SortFunc(samples, (*datastore.Key).Compare)
+
+	var splits datastore.Keys
+	for i := 1; i < n && len(samples) != 0; i++ {
+		key := samples[i*len(samples)/n]
+		if len(splits) != 0 && splits[len(splits)-1].Compare(key) == 0 {
+			continue
+		}
+		splits = append(splits, key)
+	}
+	return splits
+}
+
+// partitionQueries splits the query into the key ranges divided by the split keys.
+func partitionQueries(query *datastore.Query, splits datastore.Keys) []*datastore.Query {
+	queries := make([]*datastore.Query, 0, len(splits)+1)
+	for i := range len(splits) + 1 {
+		q := query
+		if i > 0 {
+			q = q.FilterField("__key__", ">=", splits[i-1].ToDatastore())
+		}
+		if i < len(splits) {
+			q = q.FilterField("__key__", "<", splits[i].ToDatastore())
+		}
+		queries = append(queries, q)
+	}
+	return queries
+}
+
+// resultWriter writes a query result to w.
+type resultWriter func(w io.Writer, encoder *json.Encoder, key *clouddatastore.Key, entity datastore.Entity) error
+
+// runPartitions queries the partitions concurrently, and writes the results to stdout or the shard files in outputDir.
+// It stops the other partitions after a partition fails.
+func runPartitions(ctx context.Context, client *datastore.Client, queries []*datastore.Query, stdout io.Writer, outputDir, kind string, write resultWriter) error {
+	if outputDir != "" {
+		if err := os.MkdirAll(outputDir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	width := len(strconv.Itoa(len(queries) - 1))
+	for i, query := range queries {
+		wg.Go(func() {
+			var count int
+			var err error
+			if outputDir != "" {
+				path := filepath.Join(outputDir, fmt.Sprintf("%s-%0*d.jsonl", kind, width, i))
+				count, err = scanToFile(ctx, client, query, path, write)
+			} else {
+				count, err = scanToWriter(ctx, client, query, stdout, &mu, write)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("partition %d: %w", i, err)
+					cancel()
+				}
+				return
+			}
+			log.Printf("partition %d: %d results", i, count)
+		})
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func scanToFile(ctx context.Context, client *datastore.Client, query *datastore.Query, path string, write resultWriter) (count int, err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+	}()
+
+	w := bufio.NewWriter(f)
+	encoder := json.NewEncoder(w)
+	if _, err := newQueryScanner(ctx, client).scan(ctx, query, func(key *clouddatastore.Key, entity datastore.Entity) error {
+		count++
+		return write(w, encoder, key, entity)
+	}); err != nil {
+		return count, err
+	}
+	return count, w.Flush()
+}
+
+// scanToWriter writes each result at once with the lock not to interleave with the other partitions.
+func scanToWriter(ctx context.Context, client *datastore.Client, query *datastore.Query, stdout io.Writer, mu *sync.Mutex, write resultWriter) (count int, err error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	_, err = newQueryScanner(ctx, client).scan(ctx, query, func(key *clouddatastore.Key, entity datastore.Entity) error {
+		count++
+		buf.Reset()
+		if err := write(&buf, encoder, key, entity); err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		_, err := stdout.Write(buf.Bytes())
+		return err
+	})
+	return count, err
+}
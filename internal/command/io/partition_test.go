@@ -0,0 +1,57 @@
+package io
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+func TestChooseSplitKeys(t *testing.T) {
+	t.Parallel()
+
+	newKeys := func(ids ...int64) datastore.Keys {
+		keys := make(datastore.Keys, len(ids))
+		for i, id := range ids {
+			keys[i] = &datastore.Key{Kind: "Foo", ID: id}
+		}
+		return keys
+	}
+
+	tests := []struct {
+		name    string
+		samples datastore.Keys
+		n       int
+		want    datastore.Keys
+	}{
+		{
+			name:    "even",
+			samples: newKeys(8, 3, 6, 1, 5, 2, 7, 4),
+			n:       4,
+			want:    newKeys(3, 5, 7),
+		},
+		{
+			name:    "too few samples",
+			samples: newKeys(2, 1),
+			n:       4,
+			want:    newKeys(1, 2),
+		},
+		{
+			name:    "no samples",
+			samples: nil,
+			n:       4,
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := chooseSplitKeys(tt.samples, tt.n)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected split keys (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package io
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/karupanerura/dutil/internal/command"
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+type PatchCommand struct {
+	DatastoreOptions
+	BatchOptions
+	Force  bool `name:"force" short:"f" optional:"" env:"DATASTORE_CLI_FORCE_PATCH" help:"Force patch without confirmation"`
+	Commit bool `name:"commit" short:"c" optional:"" help:"Commit transaction without confirmation"`
+	Silent bool `name:"silent" short:"s" optional:"" help:"Silent mode"`
+}
+
+func (r *PatchCommand) Run(ctx context.Context, opts command.GlobalOptions) error {
+	client, err := r.DatastoreOptions.CreateClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	runner := &mutationRunner{
+		client:         client,
+		batchSize:      r.BatchSize,
+		parallelism:    r.Parallelism,
+		expectCount:    r.ExpectCount,
+		checkpoint:     r.Checkpoint,
+		silent:         r.Silent,
+		force:          r.Force,
+		stdout:         opts.Stdout,
+		askCommit:      !r.Force && !r.Commit,
+		operation:      "patch",
+		confirmMessage: "Patch these entities?",
+		commitFunc: func(ctx context.Context, batch mutationBatch) error {
+			return commitPatches(ctx, client, batch)
+		},
+	}
+	return runner.run(ctx, newPatchSource(opts.Stdin))
+}
+
+// commitPatches looks up the entities, merges the patches into them and puts them back in a transaction.
+// Patches for the same key are merged in input order.
+func commitPatches(ctx context.Context, client *datastore.Client, batch mutationBatch) error {
+	var keys datastore.Keys
+	indexes := make([]int, len(batch.keys))
+	seen := make(map[string]int, len(batch.keys))
+	for i, key := range batch.keys {
+		index, ok := seen[key.String()]
+		if !ok {
+			index = len(keys)
+			seen[key.String()] = index
+			keys = append(keys, key)
+		}
+		indexes[i] = index
+	}
+
+	dsKeys := keys.ToDatastore()
+	if _, err := client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
+		entities := make([]*datastore.Entity, len(dsKeys))
+		if err := tx.GetMulti(dsKeys, entities); err != nil {
+			var mErr datastore.MultiError
+			if !errors.As(err, &mErr) {
+				return fmt.Errorf("tx.GetMulti: %w", err)
+			}
+			for i, err := range mErr {
+				if errors.Is(err, datastore.ErrNoSuchEntity) {
+					return fmt.Errorf("key=%s: %w", keys[i].String(), err)
+				} else if err != nil {
+					return fmt.Errorf("tx.GetMulti: %w", err)
+				}
+			}
+		}
+
+		for i, patch := range batch.patches {
+			entity := entities[indexes[i]]
+			props, err := patch.Apply(entity.Properties)
+			if err != nil {
+				return fmt.Errorf("key=%s: %w", batch.keys[i].String(), err)
+			}
+			entity.Properties = props
+		}
+		if _, err := tx.PutMulti(dsKeys, entities); err != nil {
+			return fmt.Errorf("tx.PutMulti: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("client.RunInTransaction: %w", err)
+	}
+	return nil
+}
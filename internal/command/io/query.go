@@ -6,9 +6,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
+	"slices"
 	"strings"
 
+	clouddatastore "cloud.google.com/go/datastore"
+	"cloud.google.com/go/datastore/apiv1/datastorepb"
 	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 
 	"github.com/karupanerura/dutil/internal/command"
 	"github.com/karupanerura/dutil/internal/datastore"
@@ -32,21 +37,28 @@ func (a *FieldAndAlias) UnmarshalText(text []byte) error {
 
 type QueryCommand struct {
 	DatastoreOptions
-	Kind        string        `arg:"" name:"kind" help:"Entity kind"`
-	KeyFormat   string        `name:"key-format" enum:"json,gql,encoded,proto" default:"json" help:"Key format to output for keys only query"`
-	KeysOnly    bool          `name:"keys-only" optional:"" group:"Query" help:"Return only keys of entities"`
-	AncestorKey string        `name:"ancestor" optional:"" group:"Query" help:"Ancestor key to query (format: https://support.google.com/cloud/answer/6361641)"`
-	Distinct    bool          `name:"distinct" optional:"" group:"Query"`
-	DistinctOn  []string      `name:"distinctOn" optional:"" group:"Query"`
-	Project     []string      `name:"project" optional:"" group:"Query"`
-	Filter      string        `name:"filter" optional:"" group:"Query" help:"Entity filter query (format: GQL compound-condition https://cloud.google.com/datastore/docs/reference/gql_reference)"`
-	Order       []string      `name:"order" optional:"" group:"Query" help:"Comma separated property names with optional '-' prefix for descending order"`
-	Limit       int           `name:"limit" optional:""  group:"Query" help:"Limit number of entities to query"`
-	Offset      int           `name:"offset" optional:"" group:"Query" help:"Offset number of entities to query"`
-	Explain     bool          `name:"explain" optional:"" group:"Query" help:"Explain query execution plan"`
-	Count       *string       `name:"count" optional:"" group:"Aggregation" help:"Count entities using aggregation query, the value is alias name of the count result. (e.g. --count= or --count=myAlias)"`
-	Sum         FieldAndAlias `name:"sum" optional:"" group:"Aggregation" help:"Sum entities field using aggregation query, the value is a target field name and optional alias name. (e.g. --sum=myField or --sum=myField=myAlias)"`
-	Average     FieldAndAlias `name:"avg" optional:"" group:"Aggregation" help:"Average entities field using aggregation query, the value is a target field name and optional alias name. (e.g. --sum=myField or --sum=myField=myAlias)"`
+	NamespaceOptions
+	CursorOptions
+	ReadTimeOptions
+	Kind         string          `arg:"" name:"kind" optional:"" help:"Entity kind. If empty or omitted, query entities of all kinds under --ancestor (kindless ancestor query)"`
+	KeyFormat    string          `name:"key-format" enum:"json,gql,encoded,proto" default:"json" help:"Key format to output for keys only query"`
+	KeysOnly     bool            `name:"keys-only" optional:"" group:"Query" help:"Return only keys of entities"`
+	AncestorKey  string          `name:"ancestor" optional:"" group:"Query" help:"Ancestor key to query (format: https://support.google.com/cloud/answer/6361641)"`
+	Distinct     bool            `name:"distinct" optional:"" group:"Query"`
+	DistinctOn   []string        `name:"distinctOn" optional:"" group:"Query"`
+	Project      []string        `name:"project" optional:"" group:"Query"`
+	Filter       string          `name:"filter" optional:"" group:"Query" help:"Entity filter query (format: GQL compound-condition https://cloud.google.com/datastore/docs/reference/gql_reference)"`
+	Order        []string        `name:"order" optional:"" group:"Query" help:"Comma separated property names with optional '-' prefix for descending order"`
+	Limit        int             `name:"limit" optional:""  group:"Query" help:"Limit number of entities to query"`
+	Offset       int             `name:"offset" optional:"" group:"Query" help:"Offset number of entities to query"`
+	WithMetadata bool            `name:"with-metadata" optional:"" group:"Query" help:"Query with internal metadata (version, create and update time) of each entity in datastore"`
+	Explain      ExplainMode     `name:"explain" optional:"" group:"Query" help:"Explain query execution plan. --explain or --explain=analyze executes the query and bills the reads, and --explain=plan only plans it without execution"`
+	Count        []string        `name:"count" optional:"" sep:"none" placeholder:"ALIAS" group:"Aggregation" help:"Count entities using aggregation query, the value is alias name of the count result. Repeatable. (e.g. --count= or --count=myAlias)"`
+	CountUpTo    []FieldAndAlias `name:"count-up-to" optional:"" sep:"none" placeholder:"LIMIT[=ALIAS]" group:"Aggregation" help:"Count entities up to the limit using aggregation query, the value is the limit and optional alias name. Repeatable. (e.g. --count-up-to=1000 or --count-up-to=1000=myAlias)"`
+	Sum          []FieldAndAlias `name:"sum" optional:"" sep:"none" placeholder:"FIELD[=ALIAS]" group:"Aggregation" help:"Sum entities field using aggregation query, the value is a target field name and optional alias name. Repeatable. (e.g. --sum=myField or --sum=myField=myAlias)"`
+	Average      []FieldAndAlias `name:"avg" optional:"" sep:"none" placeholder:"FIELD[=ALIAS]" group:"Aggregation" help:"Average entities field using aggregation query, the value is a target field name and optional alias name. Repeatable. (e.g. --avg=myField or --avg=myField=myAlias)"`
+	Partitions   int             `name:"partitions" optional:"" group:"Partition" help:"Split the key space of the kind into N ranges by sampling __scatter__ property and query them concurrently"`
+	OutputDir    string          `name:"output-dir" optional:"" type:"path" group:"Partition" help:"Write the results of each partition to a shard file (<kind>-<index>.jsonl) in the directory instead of stdout (requires --partitions)"`
 }
 
 func (r *QueryCommand) Run(ctx context.Context, opts command.GlobalOptions) error {
@@ -55,21 +67,51 @@ func (r *QueryCommand) Run(ctx context.Context, opts command.GlobalOptions) erro
 		return err
 	}
 	defer client.Close()
+	client, err = r.applyReadTime(client)
+	if err != nil {
+		return err
+	}
 
-	query := datastore.NewQuery(r.Kind)
-	if r.KeysOnly {
-		query = query.KeysOnly()
+	if r.NamespaceOptions.specified() {
+		switch {
+		case r.CursorOptions.specified():
+			return fmt.Errorf("cursor options cannot be used across namespaces")
+		case r.Partitions > 1:
+			return fmt.Errorf("--partitions cannot be used across namespaces")
+		case r.Explain.enabled():
+			return fmt.Errorf("--explain cannot be used across namespaces")
+		}
+		return r.NamespaceOptions.forEachNamespace(ctx, client, r.Namespace, func(namespace string) error {
+			q := *r
+			q.Namespace = namespace
+			return q.run(ctx, client, opts)
+		})
 	}
-	if r.Namespace != "" {
-		query = query.Namespace(r.Namespace)
+	return r.run(ctx, client, opts)
+}
+
+// run runs the query in the namespace of --namespace option.
+func (r *QueryCommand) run(ctx context.Context, client *datastore.Client, opts command.GlobalOptions) error {
+	if r.Kind == "" && r.AncestorKey == "" {
+		return fmt.Errorf("kindless queries require --ancestor")
 	}
-	if r.AncestorKey != "" {
-		keyParser := &parser.KeyParser{Namespace: r.Namespace}
-		key, err := keyParser.ParseKey(r.AncestorKey)
-		if err != nil {
-			return fmt.Errorf("keyParser.ParseKey: %w", err)
+	if r.WithMetadata {
+		switch {
+		case r.KeysOnly:
+			return fmt.Errorf("--with-metadata cannot be used with --keys-only")
+		case r.Explain.enabled(), len(r.Count) != 0, len(r.CountUpTo) != 0, len(r.Sum) != 0, len(r.Average) != 0:
+			return fmt.Errorf("--with-metadata cannot be used with --explain and aggregations")
+		case r.Partitions > 1:
+			return fmt.Errorf("--with-metadata cannot be used with --partitions")
 		}
-		query = query.Ancestor(key.ToDatastore())
+	}
+
+	query, err := newFilteredQuery(r.Kind, r.Namespace, r.AncestorKey, r.Filter)
+	if err != nil {
+		return err
+	}
+	if r.KeysOnly {
+		query = query.KeysOnly()
 	}
 	if r.Distinct {
 		query = query.Distinct()
@@ -80,17 +122,6 @@ func (r *QueryCommand) Run(ctx context.Context, opts command.GlobalOptions) erro
 	if len(r.Project) != 0 {
 		query = query.Project(r.Project...)
 	}
-	if r.Filter != "" {
-		filterParser := &parser.FilterParser{Namespace: r.Namespace}
-		ancestor, filter, err := filterParser.ParseFilter(r.Filter)
-		if err != nil {
-			return fmt.Errorf("filterParser.ParseFilter: %w", err)
-		}
-		if ancestor != nil {
-			return fmt.Errorf("ancestor condition is not supported, use --ancestor option instead")
-		}
-		query = query.FilterEntity(filter)
-	}
 	for _, order := range r.Order {
 		query = query.Order(order)
 	}
@@ -100,23 +131,51 @@ func (r *QueryCommand) Run(ctx context.Context, opts command.GlobalOptions) erro
 	if r.Offset != 0 {
 		query = query.Offset(r.Offset)
 	}
-	if r.Count != nil || r.Sum.Field != "" || r.Average.Field != "" {
-		aq := query.NewAggregationQuery()
-		if r.Count != nil {
-			aq = aq.WithCount(string(*r.Count))
+	query, err = r.applyCursors(query)
+	if err != nil {
+		return err
+	}
+	if r.Partitions > 1 {
+		return r.runPartitions(ctx, client, query, opts)
+	} else if r.OutputDir != "" {
+		return fmt.Errorf("--output-dir requires --partitions")
+	}
+	aggregations, err := newAggregations(r.Kind, r.Count, r.CountUpTo, r.Sum, r.Average)
+	if err != nil {
+		return err
+	}
+	if len(aggregations) != 0 {
+		if r.EmitCursor != "" {
+			return fmt.Errorf("--emit-cursor is not supported for aggregation queries")
 		}
-		if r.Sum.Field != "" {
-			aq = aq.WithSum(r.Sum.Field, r.Sum.Alias)
+
+		lowLevel := slices.ContainsFunc(aggregations, func(a aggregation) bool { return !a.supportedBySDK() })
+		if r.Explain.enabled() {
+			var metrics *datastore.ExplainMetrics
+			if lowLevel {
+				metrics, err = r.explainLowLevelAggregationQuery(ctx, client, aggregations)
+			} else {
+				var res clouddatastore.AggregationWithOptionsResult
+				res, err = client.RunAggregationQueryWithOptions(ctx, newAggregationQuery(query, aggregations), r.Explain.options())
+				metrics = res.ExplainMetrics
+			}
+			if err != nil {
+				return err
+			}
+			return json.NewEncoder(opts.Stdout).Encode(metrics)
 		}
-		if r.Average.Field != "" {
-			aq = aq.WithAvg(r.Average.Field, r.Average.Alias)
+
+		var ar map[string]any
+		if lowLevel {
+			ar, err = r.runLowLevelAggregationQuery(ctx, client, aggregations)
+		} else {
+			ar, err = client.RunAggregationQuery(ctx, newAggregationQuery(query, aggregations))
 		}
-		ar, err := client.RunAggregationQuery(ctx, aq)
 		if err != nil {
 			return err
 		}
 
-		props := datastore.NewPropertiesByProtoValueMap(ar)
+		props := r.tagNamespace(r.Namespace, datastore.NewPropertiesByProtoValueMap(ar))
 		b, err := json.Marshal(props)
 		if err != nil {
 			return err
@@ -129,16 +188,11 @@ func (r *QueryCommand) Run(ctx context.Context, opts command.GlobalOptions) erro
 		return nil
 	}
 
-	options := []datastore.RunOption{}
-	if r.Explain {
-		options = append(options, datastore.ExplainOptions{Analyze: true})
-	}
-
 	keyFormatter := datastore.KeyFormatter{Format: r.KeyFormat}
 
-	iter := client.RunWithOptions(ctx, query, options...)
-	if r.Explain {
+	if r.Explain.enabled() {
 		// read all
+		iter := client.RunWithOptions(ctx, query, r.Explain.options())
 		for {
 			if _, err := iter.Next(nil); err == iterator.Done {
 				return json.NewEncoder(opts.Stdout).Encode(iter.ExplainMetrics)
@@ -148,19 +202,195 @@ func (r *QueryCommand) Run(ctx context.Context, opts command.GlobalOptions) erro
 		}
 	}
 
+	if r.WithMetadata {
+		return r.runWithMetadata(ctx, client, opts)
+	}
+
 	encoder := json.NewEncoder(opts.Stdout)
-	for {
-		var entity datastore.Entity
-		key, err := iter.Next(&entity)
-		if err == iterator.Done {
-			break
-		} else if err != nil {
-			return err
+	cursor, err := newQueryScanner(ctx, client).scan(ctx, query, func(key *clouddatastore.Key, entity datastore.Entity) error {
+		return writeQueryResult(opts.Stdout, encoder, keyFormatter, key, entity, r.KeysOnly)
+	})
+	if err != nil {
+		return err
+	}
+	return r.emitCursor(opts.Stdout, opts.Stderr, cursor)
+}
+
+// runLowLevelAggregationQuery runs the aggregation query by the low-level client for aggregations the SDK does not support.
+func (r *QueryCommand) runLowLevelAggregationQuery(ctx context.Context, client *datastore.Client, aggregations []aggregation) (map[string]any, error) {
+	aq, err := r.newLowLevelAggregationQuery(aggregations)
+	if err != nil {
+		return nil, err
+	}
+	return datastore.NewLowLevelClient(client).RunAggregationQuery(ctx, r.Namespace, aq)
+}
+
+// explainLowLevelAggregationQuery explains the aggregation query by the low-level client for aggregations the SDK does not support.
+func (r *QueryCommand) explainLowLevelAggregationQuery(ctx context.Context, client *datastore.Client, aggregations []aggregation) (*datastore.ExplainMetrics, error) {
+	aq, err := r.newLowLevelAggregationQuery(aggregations)
+	if err != nil {
+		return nil, err
+	}
+	return datastore.NewLowLevelClient(client).ExplainAggregationQuery(ctx, r.Namespace, aq, r.Explain.options())
+}
+
+// runWithMetadata runs the query by the low-level client, which returns the metadata of each entity.
+func (r *QueryCommand) runWithMetadata(ctx context.Context, client *datastore.Client, opts command.GlobalOptions) error {
+	query, err := r.newProtoQuery()
+	if err != nil {
+		return err
+	}
+	for _, name := range r.Project {
+		query.Projection = append(query.Projection, &datastorepb.Projection{Property: &datastorepb.PropertyReference{Name: name}})
+	}
+	distinctOn := r.DistinctOn
+	if r.Distinct {
+		distinctOn = r.Project
+	}
+	for _, name := range distinctOn {
+		query.DistinctOn = append(query.DistinctOn, &datastorepb.PropertyReference{Name: name})
+	}
+
+	encoder := json.NewEncoder(opts.Stdout)
+	llc := datastore.NewLowLevelClient(client)
+	run := func(query *datastorepb.Query, fn func(*datastore.Entity, []byte) error) ([]byte, error) {
+		return llc.RunQuery(ctx, r.Namespace, query, fn)
+	}
+	end, err := newQueryScanner(ctx, client).scanLowLevel(ctx, run, query, func(entity *datastore.Entity) error {
+		return encoder.Encode(entity)
+	})
+	if err != nil {
+		return err
+	}
+	cursor, err := datastore.CursorFromBytes(end)
+	if err != nil {
+		return err
+	}
+	return r.emitCursor(opts.Stdout, opts.Stderr, cursor)
+}
+
+func (r *QueryCommand) newLowLevelAggregationQuery(aggregations []aggregation) (*datastorepb.AggregationQuery, error) {
+	query, err := r.newProtoQuery()
+	if err != nil {
+		return nil, err
+	}
+
+	protoAggregations := make([]*datastorepb.AggregationQuery_Aggregation, len(aggregations))
+	for i, a := range aggregations {
+		protoAggregations[i] = a.toProto()
+	}
+	return &datastorepb.AggregationQuery{
+		QueryType:    &datastorepb.AggregationQuery_NestedQuery{NestedQuery: query},
+		Aggregations: protoAggregations,
+	}, nil
+}
+
+// newProtoQuery creates a low-level query with the conditions, the order, the limit, the offset and the cursors.
+func (r *QueryCommand) newProtoQuery() (*datastorepb.Query, error) {
+	ancestor, filter, err := parseQueryConditions(r.Namespace, r.AncestorKey, r.Filter)
+	if err != nil {
+		return nil, err
+	}
+	query, err := datastore.NewProtoQuery(r.Kind, ancestor, filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, order := range r.Order {
+		direction := datastorepb.PropertyOrder_ASCENDING
+		if name, ok := strings.CutPrefix(order, "-"); ok {
+			direction = datastorepb.PropertyOrder_DESCENDING
+			order = name
 		}
+		query.Order = append(query.Order, &datastorepb.PropertyOrder{
+			Property:  &datastorepb.PropertyReference{Name: order},
+			Direction: direction,
+		})
+	}
+	if r.Limit != 0 {
+		query.Limit = wrapperspb.Int32(int32(r.Limit))
+	}
+	query.Offset = int32(r.Offset)
+	if query.StartCursor, err = datastore.DecodeCursorBytes(r.StartCursor); err != nil {
+		return nil, fmt.Errorf("invalid start cursor: %w", err)
+	}
+	if query.EndCursor, err = datastore.DecodeCursorBytes(r.EndCursor); err != nil {
+		return nil, fmt.Errorf("invalid end cursor: %w", err)
+	}
+	return query, nil
+}
 
-		if err := writeQueryResult(opts.Stdout, encoder, keyFormatter, key, entity, r.KeysOnly); err != nil {
-			return err
+func (r *QueryCommand) runPartitions(ctx context.Context, client *datastore.Client, query *datastore.Query, opts command.GlobalOptions) error {
+	switch {
+	case len(r.Order) != 0, r.Limit != 0, r.Offset != 0:
+		return fmt.Errorf("--partitions cannot be used with --order, --limit and --offset")
+	case r.Distinct, len(r.DistinctOn) != 0:
+		return fmt.Errorf("--partitions cannot be used with --distinct and --distinctOn")
+	case r.CursorOptions.specified():
+		return fmt.Errorf("--partitions cannot be used with cursors")
+	case r.Kind == "":
+		return fmt.Errorf("--partitions cannot be used with kindless queries")
+	case r.Explain.enabled(), len(r.Count) != 0, len(r.CountUpTo) != 0, len(r.Sum) != 0, len(r.Average) != 0:
+		return fmt.Errorf("--partitions cannot be used with --explain and aggregations")
+	}
+
+	splits, err := sampleSplitKeys(ctx, client, r.Kind, r.Namespace, r.Partitions)
+	if err != nil {
+		return err
+	}
+	queries := partitionQueries(query, splits)
+	if len(queries) < r.Partitions {
+		log.Printf("split into %d partitions because of too few sampled keys", len(queries))
+	}
+
+	keyFormatter := datastore.KeyFormatter{Format: r.KeyFormat}
+	return runPartitions(ctx, client, queries, opts.Stdout, r.OutputDir, r.Kind, func(w io.Writer, encoder *json.Encoder, key *clouddatastore.Key, entity datastore.Entity) error {
+		return writeQueryResult(w, encoder, keyFormatter, key, entity, r.KeysOnly)
+	})
+}
+
+// newFilteredQuery creates a query for the kind with --ancestor and --filter options.
+func newFilteredQuery(kind, namespace, ancestorKey, filter string) (*datastore.Query, error) {
+	ancestor, entityFilter, err := parseQueryConditions(namespace, ancestorKey, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	query := datastore.NewQuery(kind)
+	if namespace != "" {
+		query = query.Namespace(namespace)
+	}
+	if ancestor != nil {
+		query = query.Ancestor(ancestor.ToDatastore())
+	}
+	if entityFilter != nil {
+		query = query.FilterEntity(entityFilter)
+	}
+	return query, nil
+}
+
+// parseQueryConditions parses --ancestor and --filter options. The results are nil if not specified.
+func parseQueryConditions(namespace, ancestorKey, filter string) (*datastore.Key, datastore.EntityFilter, error) {
+	var ancestor *datastore.Key
+	if ancestorKey != "" {
+		keyParser := &parser.KeyParser{Namespace: namespace}
+		key, err := keyParser.ParseKey(ancestorKey)
+		if err != nil {
+			return nil, nil, fmt.Errorf("keyParser.ParseKey: %w", err)
 		}
+		ancestor = key
 	}
-	return nil
+
+	var entityFilter datastore.EntityFilter
+	if filter != "" {
+		filterParser := &parser.FilterParser{Namespace: namespace}
+		filterAncestor, f, err := filterParser.ParseFilter(filter)
+		if err != nil {
+			return nil, nil, fmt.Errorf("filterParser.ParseFilter: %w", err)
+		}
+		if filterAncestor != nil {
+			return nil, nil, fmt.Errorf("ancestor condition is not supported, use --ancestor option instead")
+		}
+		entityFilter = f
+	}
+	return ancestor, entityFilter, nil
 }
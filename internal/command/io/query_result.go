@@ -11,13 +11,17 @@ import (
 
 func writeQueryResult(stdout io.Writer, encoder *json.Encoder, keyFormatter datastore.KeyFormatter, key *clouddatastore.Key, entity datastore.Entity, keysOnly bool) error {
 	if keysOnly {
-		key := keyFormatter.FormatKey(datastore.FromDatastoreKey(key))
-		if s, ok := key.(string); ok {
-			_, _ = io.WriteString(stdout, s)
-			_, _ = io.WriteString(stdout, "\n")
-			return nil
-		}
-		return encoder.Encode(key)
+		return writeKey(stdout, encoder, keyFormatter, datastore.FromDatastoreKey(key))
 	}
 	return encoder.Encode(entity)
 }
+
+func writeKey(stdout io.Writer, encoder *json.Encoder, keyFormatter datastore.KeyFormatter, key *datastore.Key) error {
+	formatted := keyFormatter.FormatKey(key)
+	if s, ok := formatted.(string); ok {
+		_, _ = io.WriteString(stdout, s)
+		_, _ = io.WriteString(stdout, "\n")
+		return nil
+	}
+	return encoder.Encode(formatted)
+}
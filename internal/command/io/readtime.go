@@ -0,0 +1,35 @@
+package io
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+type ReadTimeOptions struct {
+	// ReadTime is the time of the snapshot to read
+	ReadTime time.Time `name:"read-time" optional:"" placeholder:"RFC3339" help:"Read the snapshot of the database at the time by point-in-time recovery (e.g. 2024-01-02T14:00:00Z). It must be a whole second, and a whole minute if older than 1 hour"`
+}
+
+// readTime returns --read-time, or zero time if not specified.
+// It must be a whole second because the SDK truncates the read time of lookups to seconds
+// while queries by the low-level client read at the exact time.
+func (o *ReadTimeOptions) readTime() (time.Time, error) {
+	if o.ReadTime.Truncate(time.Second) != o.ReadTime {
+		return time.Time{}, fmt.Errorf("--read-time must be a whole second but got %s", o.ReadTime.Format(time.RFC3339Nano))
+	}
+	return o.ReadTime, nil
+}
+
+// applyReadTime makes the client read the snapshot at --read-time if specified.
+func (o *ReadTimeOptions) applyReadTime(client *datastore.Client) (*datastore.Client, error) {
+	readTime, err := o.readTime()
+	if err != nil {
+		return nil, err
+	}
+	if readTime.IsZero() {
+		return client, nil
+	}
+	return datastore.WithReadTime(client, readTime), nil
+}
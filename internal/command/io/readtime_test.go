@@ -0,0 +1,39 @@
+package io
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReadTimeOptionsReadTime(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		readTime time.Time
+		wantErr  bool
+	}{
+		{name: "not specified"},
+		{name: "whole second", readTime: time.Date(2024, 1, 2, 14, 0, 1, 0, time.UTC)},
+		{name: "sub-second", readTime: time.Date(2024, 1, 2, 14, 0, 1, 500_000_000, time.UTC), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			o := &ReadTimeOptions{ReadTime: tt.readTime}
+			got, err := o.readTime()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error but got %s", got)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.readTime) {
+				t.Errorf("readTime() = %s, want %s", got, tt.readTime)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package io
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	clouddatastore "cloud.google.com/go/datastore"
+	"cloud.google.com/go/datastore/apiv1/datastorepb"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+const (
+	maxScanRetries  = 10
+	initialScanWait = time.Second
+	maxScanWait     = 32 * time.Second
+)
+
+type queryIterator interface {
+	Next(dst any) (*clouddatastore.Key, error)
+	Cursor() (datastore.Cursor, error)
+}
+
+// queryScanner runs a query, and resumes it from the cursor after the last result
+// when it fails with a retryable error, so that each result is read exactly once.
+type queryScanner struct {
+	run        func(*datastore.Query) queryIterator
+	maxRetries int
+	wait       time.Duration
+}
+
+func newQueryScanner(ctx context.Context, client *datastore.Client, options ...datastore.RunOption) *queryScanner {
+	return &queryScanner{
+		run: func(query *datastore.Query) queryIterator {
+			return client.RunWithOptions(ctx, query, options...)
+		},
+		maxRetries: maxScanRetries,
+		wait:       initialScanWait,
+	}
+}
+
+// scan calls fn for each result of the query, and returns the cursor after the last result.
+func (s *queryScanner) scan(ctx context.Context, query *datastore.Query, fn func(key *clouddatastore.Key, entity datastore.Entity) error) (datastore.Cursor, error) {
+	limit := datastore.QueryLimit(query)
+	current := query
+	var cursor datastore.Cursor
+	var read int
+	b := scanBackoff{wait: s.wait}
+	for {
+		iter := s.run(current)
+		var progressed bool
+		var err error
+		for {
+			var entity datastore.Entity
+			var key *clouddatastore.Key
+			key, err = iter.Next(&entity)
+			if err != nil {
+				break
+			}
+			if err := fn(key, entity); err != nil {
+				return datastore.Cursor{}, err
+			}
+			read++
+			progressed = true
+
+			// the iterator cannot tell the cursor after it fails, so remember it for each result
+			cursor, err = iter.Cursor()
+			if err != nil {
+				return datastore.Cursor{}, fmt.Errorf("iter.Cursor: %w", err)
+			}
+		}
+		if errors.Is(err, iterator.Done) {
+			return iter.Cursor()
+		}
+		if !isRetryableScanError(ctx, err) {
+			return datastore.Cursor{}, err
+		}
+		if limit >= 0 && read >= limit {
+			return cursor, nil
+		}
+
+		if progressed {
+			// resume after the last result, whose offset has already been skipped
+			current = query.Start(cursor).Offset(0)
+			if limit >= 0 {
+				current = current.Limit(limit - read)
+			}
+		}
+		if err := s.backoff(ctx, &b, err, read, progressed); err != nil {
+			return datastore.Cursor{}, err
+		}
+	}
+}
+
+// lowLevelQueryRunner runs the query by the low-level client like LowLevelClient.RunQuery.
+type lowLevelQueryRunner func(query *datastorepb.Query, fn func(entity *datastore.Entity, cursor []byte) error) ([]byte, error)
+
+// scanLowLevel calls fn for each result of the query run by the low-level client, and returns the cursor after the last result.
+// It resumes the query on retryable errors like scan.
+func (s *queryScanner) scanLowLevel(ctx context.Context, run lowLevelQueryRunner, query *datastorepb.Query, fn func(entity *datastore.Entity) error) ([]byte, error) {
+	current := query
+	var cursor []byte
+	var read int32
+	b := scanBackoff{wait: s.wait}
+	for {
+		var progressed bool
+		end, err := run(current, func(entity *datastore.Entity, c []byte) error {
+			if err := fn(entity); err != nil {
+				return err
+			}
+			read++
+			progressed = true
+			cursor = c
+			return nil
+		})
+		if err == nil {
+			return end, nil
+		}
+		if !isRetryableScanError(ctx, err) {
+			return nil, err
+		}
+		if query.Limit != nil && read >= query.Limit.GetValue() {
+			return cursor, nil
+		}
+
+		if progressed {
+			// resume after the last result, whose offset has already been skipped
+			current = proto.Clone(query).(*datastorepb.Query)
+			current.StartCursor = cursor
+			current.Offset = 0
+			if query.Limit != nil {
+				current.Limit = wrapperspb.Int32(query.Limit.GetValue() - read)
+			}
+		}
+		if err := s.backoff(ctx, &b, err, int(read), progressed); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// scanBackoff is the state of the retries of a scan.
+type scanBackoff struct {
+	retries int
+	wait    time.Duration
+}
+
+// backoff waits before retrying the query failed with the retryable error after read results.
+// The retries are counted from the last progress, and it gives up after maxRetries retries without progress.
+func (s *queryScanner) backoff(ctx context.Context, b *scanBackoff, err error, read int, progressed bool) error {
+	if progressed {
+		b.retries, b.wait = 0, s.wait
+	}
+	if b.retries >= s.maxRetries {
+		return fmt.Errorf("gave up retrying the query after %d retries: %w", b.retries, err)
+	}
+	b.retries++
+
+	log.Printf("query failed after %d results, retrying from the last cursor in %s: %v", read, b.wait, err)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(b.wait):
+	}
+	b.wait = min(b.wait*2, maxScanWait)
+	return nil
+}
+
+func isRetryableScanError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		// canceled or timed out by the caller
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	default:
+		return false
+	}
+}
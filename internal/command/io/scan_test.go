@@ -0,0 +1,313 @@
+package io
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strconv"
+	"testing"
+
+	clouddatastore "cloud.google.com/go/datastore"
+	"cloud.google.com/go/datastore/apiv1/datastorepb"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+// fakeQueryIterator returns the keys and then the error. Like the real iterator, Cursor fails after Next fails.
+type fakeQueryIterator struct {
+	keys   []*clouddatastore.Key
+	err    error
+	pos    int
+	failed bool
+}
+
+func (i *fakeQueryIterator) Next(dst any) (*clouddatastore.Key, error) {
+	if i.pos >= len(i.keys) {
+		i.failed = true
+		return nil, i.err
+	}
+	key := i.keys[i.pos]
+	i.pos++
+	return key, nil
+}
+
+func (i *fakeQueryIterator) Cursor() (datastore.Cursor, error) {
+	if i.failed && i.err != iterator.Done {
+		return datastore.Cursor{}, i.err
+	}
+	return datastore.DecodeCursor(base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(i.pos))))
+}
+
+func TestQueryScanner(t *testing.T) {
+	t.Parallel()
+
+	newKeys := func(ids ...int64) []*clouddatastore.Key {
+		keys := make([]*clouddatastore.Key, len(ids))
+		for i, id := range ids {
+			keys[i] = clouddatastore.IDKey("Foo", id, nil)
+		}
+		return keys
+	}
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	permissionDenied := status.Error(codes.PermissionDenied, "denied")
+
+	tests := []struct {
+		name       string
+		query      *datastore.Query
+		iterators  []*fakeQueryIterator
+		wantIDs    []int64
+		wantLimits []int
+		wantErr    error
+	}{
+		{
+			name:  "resume after results",
+			query: datastore.NewQuery("Foo").Limit(5).Offset(1),
+			iterators: []*fakeQueryIterator{
+				{keys: newKeys(1, 2), err: unavailable},
+				{keys: newKeys(3), err: unavailable},
+				{err: status.Error(codes.DeadlineExceeded, "timeout")},
+				{keys: newKeys(4, 5), err: iterator.Done},
+			},
+			wantIDs:    []int64{1, 2, 3, 4, 5},
+			wantLimits: []int{5, 3, 2, 2},
+		},
+		{
+			name:  "no limit",
+			query: datastore.NewQuery("Foo"),
+			iterators: []*fakeQueryIterator{
+				{keys: newKeys(1), err: unavailable},
+				{keys: newKeys(2), err: iterator.Done},
+			},
+			wantIDs:    []int64{1, 2},
+			wantLimits: []int{-1, -1},
+		},
+		{
+			name:  "limit reached",
+			query: datastore.NewQuery("Foo").Limit(2),
+			iterators: []*fakeQueryIterator{
+				{keys: newKeys(1, 2), err: unavailable},
+			},
+			wantIDs:    []int64{1, 2},
+			wantLimits: []int{2},
+		},
+		{
+			name:  "not retryable",
+			query: datastore.NewQuery("Foo"),
+			iterators: []*fakeQueryIterator{
+				{keys: newKeys(1), err: permissionDenied},
+			},
+			wantIDs:    []int64{1},
+			wantLimits: []int{-1},
+			wantErr:    permissionDenied,
+		},
+		{
+			name:  "give up",
+			query: datastore.NewQuery("Foo"),
+			iterators: []*fakeQueryIterator{
+				{keys: newKeys(1), err: unavailable},
+				{err: unavailable},
+				{err: unavailable},
+			},
+			wantIDs:    []int64{1},
+			wantLimits: []int{-1, -1, -1},
+			wantErr:    unavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var limits []int
+			scanner := &queryScanner{
+				run: func(query *datastore.Query) queryIterator {
+					limits = append(limits, datastore.QueryLimit(query))
+					return tt.iterators[len(limits)-1]
+				},
+				maxRetries: 2,
+			}
+
+			var ids []int64
+			_, err := scanner.scan(context.Background(), tt.query, func(key *clouddatastore.Key, _ datastore.Entity) error {
+				ids = append(ids, key.ID)
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.wantIDs, ids); diff != "" {
+				t.Errorf("unexpected results (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantLimits, limits); diff != "" {
+				t.Errorf("unexpected limits (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestQuerySource(t *testing.T) {
+	t.Parallel()
+
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	permissionDenied := status.Error(codes.PermissionDenied, "denied")
+	iterators := []*fakeQueryIterator{
+		{keys: []*clouddatastore.Key{clouddatastore.IDKey("Foo", 1, nil)}, err: iterator.Done},
+		{keys: []*clouddatastore.Key{clouddatastore.IDKey("Foo", 1, nil), clouddatastore.IDKey("Foo", 2, nil)}, err: unavailable},
+		{keys: []*clouddatastore.Key{clouddatastore.IDKey("Foo", 3, nil)}, err: iterator.Done},
+		{err: permissionDenied},
+	}
+	var runs int
+	scanner := &queryScanner{
+		run: func(query *datastore.Query) queryIterator {
+			runs++
+			return iterators[runs-1]
+		},
+		maxRetries: 2,
+	}
+	source := newQuerySource(context.Background(), scanner, datastore.NewQuery("Foo"), func(key *datastore.Key) *datastore.Mutation {
+		return datastore.NewDelete(key.ToDatastore())
+	})
+	defer source.Close()
+
+	readAll := func() ([]int64, error) {
+		var ids []int64
+		for {
+			entry, err := source.Next()
+			if err != nil {
+				return ids, err
+			}
+			ids = append(ids, entry.key.ID)
+		}
+	}
+
+	// rewind in the middle of the first run
+	if _, err := source.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Rewind(); err != nil {
+		t.Fatal(err)
+	}
+
+	// resumed after the retryable error
+	ids, err := readAll()
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if diff := cmp.Diff([]int64{1, 2, 3}, ids); diff != "" {
+		t.Errorf("unexpected keys (-want +got):\n%s", diff)
+	}
+
+	if err := source.Rewind(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readAll(); !errors.Is(err, permissionDenied) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if runs != len(iterators) {
+		t.Errorf("unexpected number of runs: %d", runs)
+	}
+}
+
+func TestQueryScannerScanLowLevel(t *testing.T) {
+	t.Parallel()
+
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	permissionDenied := status.Error(codes.PermissionDenied, "denied")
+
+	// each run returns the results with the cursors after them, and then the error
+	type run struct {
+		ids []int64
+		err error
+	}
+	tests := []struct {
+		name      string
+		query     *datastorepb.Query
+		runs      []run
+		wantIDs   []int64
+		wantRuns  []*datastorepb.Query
+		wantErr   error
+		wantFinal []byte
+	}{
+		{
+			name:  "resume after results",
+			query: &datastorepb.Query{Offset: 1, Limit: wrapperspb.Int32(5)},
+			runs: []run{
+				{ids: []int64{1, 2}, err: unavailable},
+				{err: status.Error(codes.DeadlineExceeded, "timeout")},
+				{ids: []int64{3, 4, 5}},
+			},
+			wantIDs: []int64{1, 2, 3, 4, 5},
+			wantRuns: []*datastorepb.Query{
+				{Offset: 1, Limit: wrapperspb.Int32(5)},
+				{StartCursor: []byte("2"), Limit: wrapperspb.Int32(3)},
+				{StartCursor: []byte("2"), Limit: wrapperspb.Int32(3)},
+			},
+			wantFinal: []byte("end"),
+		},
+		{
+			name:  "limit reached",
+			query: &datastorepb.Query{Limit: wrapperspb.Int32(2)},
+			runs: []run{
+				{ids: []int64{1, 2}, err: unavailable},
+			},
+			wantIDs:   []int64{1, 2},
+			wantRuns:  []*datastorepb.Query{{Limit: wrapperspb.Int32(2)}},
+			wantFinal: []byte("2"),
+		},
+		{
+			name:  "not retryable",
+			query: &datastorepb.Query{},
+			runs: []run{
+				{ids: []int64{1}, err: permissionDenied},
+			},
+			wantIDs:  []int64{1},
+			wantRuns: []*datastorepb.Query{{}},
+			wantErr:  permissionDenied,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var queries []*datastorepb.Query
+			run := func(query *datastorepb.Query, fn func(*datastore.Entity, []byte) error) ([]byte, error) {
+				queries = append(queries, query)
+				r := tt.runs[len(queries)-1]
+				for _, id := range r.ids {
+					if err := fn(&datastore.Entity{Key: &datastore.Key{Kind: "Foo", ID: id}}, []byte(strconv.FormatInt(id, 10))); err != nil {
+						return nil, err
+					}
+				}
+				if r.err != nil {
+					return nil, r.err
+				}
+				return []byte("end"), nil
+			}
+
+			var ids []int64
+			scanner := &queryScanner{maxRetries: 2}
+			end, err := scanner.scanLowLevel(context.Background(), run, tt.query, func(entity *datastore.Entity) error {
+				ids = append(ids, entity.Key.ID)
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tt.wantFinal, end); diff != "" {
+				t.Errorf("unexpected cursor (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantIDs, ids); diff != "" {
+				t.Errorf("unexpected results (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantRuns, queries, protocmp.Transform()); diff != "" {
+				t.Errorf("unexpected queries (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package io
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	clouddatastore "cloud.google.com/go/datastore"
+
+	"github.com/karupanerura/dutil/internal/command"
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+type SchemaCommand struct {
+	DatastoreOptions
+	Kinds     []string `arg:"" name:"kinds" optional:"" help:"Kinds to list the properties. If omitted, all kinds except the system kinds (__*__) are listed"`
+	KindsOnly bool     `name:"kinds-only" optional:"" help:"List only kinds without properties"`
+}
+
+func (r *SchemaCommand) Run(ctx context.Context, opts command.GlobalOptions) error {
+	client, err := r.DatastoreOptions.CreateClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	kinds := r.Kinds
+	if len(kinds) == 0 {
+		kinds, err = listKinds(ctx, client, r.Namespace)
+		if err != nil {
+			return err
+		}
+	}
+
+	encoder := json.NewEncoder(opts.Stdout)
+	for _, kind := range kinds {
+		if r.KindsOnly {
+			if err := encoder.Encode(newSchemaRecord(kind, nil, "")); err != nil {
+				return err
+			}
+			continue
+		}
+
+		properties, err := listProperties(ctx, client, r.Namespace, kind)
+		if err != nil {
+			return err
+		}
+		if len(properties) == 0 {
+			// no indexed properties
+			if err := encoder.Encode(newSchemaRecord(kind, nil, "")); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, property := range properties {
+			for _, representation := range property.Representations {
+				if err := encoder.Encode(newSchemaRecord(kind, &property.Name, representation)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// newSchemaRecord creates a keyless entity of the kind, the property and the representation.
+// The property and the representation are null if the property is nil.
+func newSchemaRecord(kind string, property *string, representation string) *datastore.Entity {
+	entity := &datastore.Entity{Properties: []datastore.Property{
+		{Name: "kind", Value: datastore.Value{Type: datastore.StringType, Value: kind}},
+		{Name: "property", Value: datastore.Value{Type: datastore.NullType}},
+		{Name: "representation", Value: datastore.Value{Type: datastore.NullType}},
+	}}
+	if property != nil {
+		entity.Properties[1].Value = datastore.Value{Type: datastore.StringType, Value: *property}
+		entity.Properties[2].Value = datastore.Value{Type: datastore.StringType, Value: representation}
+	}
+	return entity
+}
+
+// listKinds returns the kinds in the namespace by __kind__ kind except the system kinds.
+func listKinds(ctx context.Context, client *datastore.Client, namespace string) ([]string, error) {
+	query := datastore.NewQuery("__kind__").KeysOnly()
+	if namespace != "" {
+		query = query.Namespace(namespace)
+	}
+	keys, err := client.GetAll(ctx, query, nil)
+	if err != nil {
+		return nil, fmt.Errorf("client.GetAll: %w", err)
+	}
+
+	kinds := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if strings.HasPrefix(key.Name, "__") {
+			continue
+		}
+		kinds = append(kinds, key.Name)
+	}
+	return kinds, nil
+}
+
+// propertySchema is a property of a kind by __property__ kind.
+type propertySchema struct {
+	Name            string   `datastore:"-"`
+	Representations []string `datastore:"property_representation"`
+}
+
+// listProperties returns the indexed properties of the kind by __property__ kind.
+// Unindexed properties are not listed by Datastore.
+func listProperties(ctx context.Context, client *datastore.Client, namespace, kind string) ([]propertySchema, error) {
+	query := datastore.NewQuery("__property__").Ancestor(&clouddatastore.Key{Kind: "__kind__", Name: kind, Namespace: namespace})
+	if namespace != "" {
+		query = query.Namespace(namespace)
+	}
+
+	var properties []propertySchema
+	keys, err := client.GetAll(ctx, query, &properties)
+	if err != nil {
+		return nil, fmt.Errorf("client.GetAll: %w", err)
+	}
+	for i, key := range keys {
+		properties[i].Name = key.Name
+	}
+	return properties, nil
+}
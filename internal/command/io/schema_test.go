@@ -0,0 +1,44 @@
+package io
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewSchemaRecord(t *testing.T) {
+	t.Parallel()
+
+	property := "priority"
+	tests := []struct {
+		name           string
+		property       *string
+		representation string
+		want           string
+	}{
+		{
+			name:           "property",
+			property:       &property,
+			representation: "INT64",
+			want:           `{"key":null,"properties":[{"type":"string","value":"Task","name":"kind"},{"type":"string","value":"priority","name":"property"},{"type":"string","value":"INT64","name":"representation"}]}`,
+		},
+		{
+			name: "kind only",
+			want: `{"key":null,"properties":[{"type":"string","value":"Task","name":"kind"},{"type":"null","value":null,"name":"property"},{"type":"null","value":null,"name":"representation"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			b, err := json.Marshal(newSchemaRecord("Task", tt.property, tt.representation))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, string(b)); diff != "" {
+				t.Errorf("unexpected record (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package io
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+
+	clouddatastore "cloud.google.com/go/datastore"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+	"github.com/karupanerura/dutil/internal/parser"
+)
+
+// mutationEntry is a mutation with its source. entity is nil for deletions.
+// patch is set instead of mutation for patches, because their mutations depend on the current entities.
+type mutationEntry struct {
+	key      *datastore.Key
+	entity   *datastore.Entity
+	patch    *datastore.EntityPatch
+	mutation *datastore.Mutation
+}
+
+// mutationSource reads mutations one by one. It returns io.EOF at the end of the input.
+type mutationSource interface {
+	Next() (mutationEntry, error)
+}
+
+// rewindableSource is a mutationSource that can be read again from the beginning,
+// e.g. to count the input before confirmation in streaming mode.
+type rewindableSource interface {
+	mutationSource
+	rewindable() bool
+	Rewind() error
+}
+
+// checkpointInputSource is a mutationSource which can tell the identity of its input for the checkpoint.
+type checkpointInputSource interface {
+	mutationSource
+	checkpointInput() checkpointInput
+}
+
+// seekableInput remembers the start offset of the input to rewind it if it is seekable.
+type seekableInput struct {
+	reader   io.Reader
+	seekable bool
+	offset   int64
+}
+
+func newSeekableInput(reader io.Reader) seekableInput {
+	in := seekableInput{reader: reader}
+	if seeker, ok := reader.(io.Seeker); ok {
+		// pipes and terminals implement io.Seeker but fail to seek
+		if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			in.seekable = true
+			in.offset = offset
+		}
+	}
+	return in
+}
+
+func (in *seekableInput) rewindable() bool {
+	return in.seekable
+}
+
+// checkpointInput returns the identity of the input if it is a file.
+func (in *seekableInput) checkpointInput() checkpointInput {
+	file, ok := in.reader.(*os.File)
+	if !ok {
+		return checkpointInput{}
+	}
+	return newCheckpointInput(file)
+}
+
+func (in *seekableInput) rewind() error {
+	_, err := in.reader.(io.Seeker).Seek(in.offset, io.SeekStart)
+	return err
+}
+
+type entitySource struct {
+	seekableInput
+	decoder     *json.Decoder
+	newMutation func(*datastore.Entity) *datastore.Mutation
+}
+
+func newEntitySource(reader io.Reader, newMutation func(*datastore.Entity) *datastore.Mutation) *entitySource {
+	return &entitySource{
+		seekableInput: newSeekableInput(reader),
+		decoder:       json.NewDecoder(reader),
+		newMutation:   newMutation,
+	}
+}
+
+func (s *entitySource) Next() (mutationEntry, error) {
+	var entity *datastore.Entity
+	if err := s.decoder.Decode(&entity); err != nil {
+		return mutationEntry{}, err
+	}
+	if entity == nil || entity.Key == nil {
+		return mutationEntry{}, fmt.Errorf("entity without key at offset %d", s.decoder.InputOffset())
+	}
+	return mutationEntry{key: entity.Key, entity: entity, mutation: s.newMutation(entity)}, nil
+}
+
+func (s *entitySource) Rewind() error {
+	if err := s.rewind(); err != nil {
+		return err
+	}
+	s.decoder = json.NewDecoder(s.reader)
+	return nil
+}
+
+type patchSource struct {
+	seekableInput
+	decoder *json.Decoder
+}
+
+func newPatchSource(reader io.Reader) *patchSource {
+	return &patchSource{
+		seekableInput: newSeekableInput(reader),
+		decoder:       json.NewDecoder(reader),
+	}
+}
+
+func (s *patchSource) Next() (mutationEntry, error) {
+	var patch *datastore.EntityPatch
+	if err := s.decoder.Decode(&patch); err != nil {
+		return mutationEntry{}, err
+	}
+	if patch == nil || patch.Key == nil {
+		return mutationEntry{}, fmt.Errorf("patch without key at offset %d", s.decoder.InputOffset())
+	}
+	return mutationEntry{key: patch.Key, patch: patch}, nil
+}
+
+func (s *patchSource) Rewind() error {
+	if err := s.rewind(); err != nil {
+		return err
+	}
+	s.decoder = json.NewDecoder(s.reader)
+	return nil
+}
+
+// keyReaderSource reads keys in any key format from the input.
+type keyReaderSource struct {
+	seekableInput
+	keyReader   parser.KeyReader
+	keyParser   *parser.KeyParser
+	newMutation func(*datastore.Key) *datastore.Mutation
+}
+
+func newKeyReaderSource(reader io.Reader, keyParser *parser.KeyParser, newMutation func(*datastore.Key) *datastore.Mutation) (*keyReaderSource, error) {
+	s := &keyReaderSource{
+		seekableInput: newSeekableInput(reader),
+		keyParser:     keyParser,
+		newMutation:   newMutation,
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *keyReaderSource) open() (err error) {
+	s.keyReader, err = parser.NewKeyReader("auto", s.reader, s.keyParser)
+	if errors.Is(err, io.EOF) {
+		// empty input
+		s.keyReader = nil
+		return nil
+	}
+	return
+}
+
+func (s *keyReaderSource) Next() (mutationEntry, error) {
+	if s.keyReader == nil {
+		return mutationEntry{}, io.EOF
+	}
+	key, err := s.keyReader.Read()
+	if err != nil {
+		return mutationEntry{}, err
+	}
+	return mutationEntry{key: key, mutation: s.newMutation(key)}, nil
+}
+
+func (s *keyReaderSource) Rewind() error {
+	if err := s.rewind(); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+type keySource struct {
+	keys        datastore.Keys
+	newMutation func(*datastore.Key) *datastore.Mutation
+	index       int
+}
+
+func (s *keySource) Next() (mutationEntry, error) {
+	if s.index >= len(s.keys) {
+		return mutationEntry{}, io.EOF
+	}
+	key := s.keys[s.index]
+	s.index++
+	return mutationEntry{key: key, mutation: s.newMutation(key)}, nil
+}
+
+func (s *keySource) rewindable() bool {
+	return true
+}
+
+func (s *keySource) Rewind() error {
+	s.index = 0
+	return nil
+}
+
+// errStopQuery stops the scan of querySource when it is rewound or closed before the end.
+var errStopQuery = errors.New("query stopped")
+
+// querySource streams the keys of a keys-only query with the queryScanner,
+// so that the keys are not held in memory and the query is resumed on retryable errors.
+// It is rewound by running the query again.
+type querySource struct {
+	ctx         context.Context
+	scanner     *queryScanner
+	query       *datastore.Query
+	newMutation func(*datastore.Key) *datastore.Mutation
+	next        func() (*clouddatastore.Key, error, bool)
+	stop        func()
+}
+
+func newQuerySource(ctx context.Context, scanner *queryScanner, query *datastore.Query, newMutation func(*datastore.Key) *datastore.Mutation) *querySource {
+	s := &querySource{
+		ctx:         ctx,
+		scanner:     scanner,
+		query:       query.KeysOnly(),
+		newMutation: newMutation,
+	}
+	s.open()
+	return s
+}
+
+func (s *querySource) open() {
+	s.next, s.stop = iter.Pull2(func(yield func(*clouddatastore.Key, error) bool) {
+		_, err := s.scanner.scan(s.ctx, s.query, func(key *clouddatastore.Key, _ datastore.Entity) error {
+			if !yield(key, nil) {
+				return errStopQuery
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopQuery) {
+			yield(nil, err)
+		}
+	})
+}
+
+func (s *querySource) Next() (mutationEntry, error) {
+	dsKey, err, ok := s.next()
+	if !ok {
+		return mutationEntry{}, io.EOF
+	} else if err != nil {
+		return mutationEntry{}, err
+	}
+	key := datastore.FromDatastoreKey(dsKey)
+	return mutationEntry{key: key, mutation: s.newMutation(key)}, nil
+}
+
+func (s *querySource) rewindable() bool {
+	return true
+}
+
+func (s *querySource) Rewind() error {
+	s.stop()
+	s.open()
+	return nil
+}
+
+// Close stops the query if it has not been read to the end.
+func (s *querySource) Close() {
+	s.stop()
+}
@@ -0,0 +1,138 @@
+package io
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/karupanerura/dutil/internal/command"
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+type StatsCommand struct {
+	DatastoreOptions
+	Kinds []string `arg:"" name:"kinds" optional:"" help:"Kinds to show the statistics. If omitted, all kinds are shown"`
+	By    string   `name:"by" enum:"total,kind,property-type,property-name,namespace" default:"kind" help:"Level of the statistics (total, kind, property-type, property-name or namespace)"`
+}
+
+// statsLevel is a level of the built-in statistics.
+type statsLevel struct {
+	// kind is the statistics kind name without __Stat_ prefix and __ suffix
+	kind string
+
+	// keyColumns are the property names to identify the statistics in order
+	keyColumns []string
+
+	// sizeColumns are the property names of the sizes in order
+	sizeColumns []string
+
+	// namespaced reports whether the level has __Stat_Ns_*__ variant for --namespace
+	namespaced bool
+}
+
+var (
+	statsSizeColumns         = []string{"count", "bytes", "entity_bytes", "builtin_index_bytes", "composite_index_bytes", "timestamp"}
+	statsPropertySizeColumns = []string{"count", "bytes", "entity_bytes", "builtin_index_bytes", "timestamp"}
+)
+
+var statsLevels = map[string]statsLevel{
+	"total":         {kind: "Total", sizeColumns: statsSizeColumns, namespaced: true},
+	"kind":          {kind: "Kind", keyColumns: []string{"kind_name"}, sizeColumns: statsSizeColumns, namespaced: true},
+	"property-type": {kind: "PropertyType_Kind", keyColumns: []string{"kind_name", "property_type"}, sizeColumns: statsPropertySizeColumns, namespaced: true},
+	"property-name": {kind: "PropertyName_Kind", keyColumns: []string{"kind_name", "property_name"}, sizeColumns: statsPropertySizeColumns, namespaced: true},
+	"namespace":     {kind: "Namespace", keyColumns: []string{"subject_namespace"}, sizeColumns: statsSizeColumns},
+}
+
+func (l statsLevel) columns() []string {
+	return slices.Concat(l.keyColumns, l.sizeColumns)
+}
+
+// statsKind returns the statistics kind of the level. The statistics of a namespace are __Stat_Ns_*__ kinds in the namespace.
+func (l statsLevel) statsKind(namespace string) (string, error) {
+	if namespace == "" {
+		return "__Stat_" + l.kind + "__", nil
+	}
+	if !l.namespaced {
+		return "", fmt.Errorf("__Stat_%s__ is only in the default namespace", l.kind)
+	}
+	return "__Stat_Ns_" + l.kind + "__", nil
+}
+
+func (r *StatsCommand) Run(ctx context.Context, opts command.GlobalOptions) error {
+	level := statsLevels[r.By]
+	kind, err := level.statsKind(r.Namespace)
+	if err != nil {
+		return err
+	}
+	if len(r.Kinds) != 0 && !slices.Contains(level.keyColumns, "kind_name") {
+		return fmt.Errorf("kinds cannot be specified for the statistics by %s", r.By)
+	}
+
+	client, err := r.DatastoreOptions.CreateClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	query := datastore.NewQuery(kind)
+	if r.Namespace != "" {
+		query = query.Namespace(r.Namespace)
+	}
+	var entities []*datastore.Entity
+	if _, err := client.GetAll(ctx, query, &entities); err != nil {
+		return fmt.Errorf("client.GetAll: %w", err)
+	}
+
+	records := make([]*datastore.Entity, 0, len(entities))
+	for _, entity := range entities {
+		record := newStatsRecord(entity, level.columns())
+		if len(r.Kinds) != 0 && !slices.Contains(r.Kinds, statsString(record, "kind_name")) {
+			continue
+		}
+		records = append(records, record)
+	}
+	slices.SortStableFunc(records, func(a, b *datastore.Entity) int {
+		for _, column := range level.keyColumns {
+			if c := cmp.Compare(statsString(a, column), statsString(b, column)); c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+
+	encoder := json.NewEncoder(opts.Stdout)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newStatsRecord creates a keyless entity with the columns of the statistics entity in order. Missing columns are null.
+func newStatsRecord(entity *datastore.Entity, columns []string) *datastore.Entity {
+	record := &datastore.Entity{Properties: make([]datastore.Property, len(columns))}
+	for i, column := range columns {
+		record.Properties[i] = datastore.Property{Name: column, Value: datastore.Value{Type: datastore.NullType}}
+		for _, prop := range entity.Properties {
+			if prop.Name == column {
+				record.Properties[i].Value = prop.Value
+				break
+			}
+		}
+	}
+	return record
+}
+
+// statsString returns the string value of the column, or an empty string if it is not a string.
+func statsString(record *datastore.Entity, column string) string {
+	for _, prop := range record.Properties {
+		if prop.Name == column {
+			s, _ := prop.Value.Value.(string)
+			return s
+		}
+	}
+	return ""
+}
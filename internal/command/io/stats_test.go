@@ -0,0 +1,71 @@
+package io
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+func TestStatsLevelStatsKind(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		by        string
+		namespace string
+		want      string
+		wantErr   bool
+	}{
+		{by: "kind", want: "__Stat_Kind__"},
+		{by: "kind", namespace: "tenant", want: "__Stat_Ns_Kind__"},
+		{by: "property-type", namespace: "tenant", want: "__Stat_Ns_PropertyType_Kind__"},
+		{by: "namespace", want: "__Stat_Namespace__"},
+		{by: "namespace", namespace: "tenant", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.by+"/"+tt.namespace, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := statsLevels[tt.by].statsKind(tt.namespace)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("unexpected kind: %s", got)
+			}
+		})
+	}
+}
+
+func TestNewStatsRecord(t *testing.T) {
+	t.Parallel()
+
+	timestamp := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	entity := &datastore.Entity{Properties: []datastore.Property{
+		{Name: "timestamp", Value: datastore.Value{Type: datastore.TimestampType, Value: timestamp}},
+		{Name: "bytes", Value: datastore.Value{Type: datastore.IntType, Value: int64(2048)}},
+		{Name: "kind_name", Value: datastore.Value{Type: datastore.StringType, Value: "Task"}},
+		{Name: "count", Value: datastore.Value{Type: datastore.IntType, Value: int64(10)}},
+		{Name: "ignored", Value: datastore.Value{Type: datastore.IntType, Value: int64(1)}},
+	}}
+	columns := []string{"kind_name", "count", "bytes", "composite_index_bytes", "timestamp"}
+
+	got := newStatsRecord(entity, columns)
+	want := &datastore.Entity{Properties: []datastore.Property{
+		{Name: "kind_name", Value: datastore.Value{Type: datastore.StringType, Value: "Task"}},
+		{Name: "count", Value: datastore.Value{Type: datastore.IntType, Value: int64(10)}},
+		{Name: "bytes", Value: datastore.Value{Type: datastore.IntType, Value: int64(2048)}},
+		{Name: "composite_index_bytes", Value: datastore.Value{Type: datastore.NullType}},
+		{Name: "timestamp", Value: datastore.Value{Type: datastore.TimestampType, Value: timestamp}},
+	}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected record (-want +got):\n%s", diff)
+	}
+}
@@ -2,19 +2,23 @@ package io
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"log"
+	"sync"
+
+	"cloud.google.com/go/datastore/apiv1/datastorepb"
 	"github.com/karupanerura/dutil/internal/command"
 	"github.com/karupanerura/dutil/internal/datastore"
-	"io"
-	"log"
 )
 
 type UpdateCommand struct {
 	DatastoreOptions
-	Force  bool `name:"force" short:"f" optional:"" env:"DATASTORE_CLI_FORCE_UPDATE" help:"Force update without confirmation"`
-	Commit bool `name:"commit" short:"c" optional:"" help:"Commit transaction without confirmation"`
-	Silent bool `name:"silent" short:"s" optional:"" help:"Silent mode"`
+	BatchOptions
+	Force     bool `name:"force" short:"f" optional:"" env:"DATASTORE_CLI_FORCE_UPDATE" help:"Force update without confirmation"`
+	Commit    bool `name:"commit" short:"c" optional:"" help:"Commit transaction without confirmation"`
+	Silent    bool `name:"silent" short:"s" optional:"" help:"Silent mode"`
+	DryRun    bool `name:"dry-run" optional:"" help:"Show differences from the current entities without committing"`
+	IfVersion bool `name:"if-version" optional:"" help:"Update only if the entities are not changed since the version in their metadata (requires entities from lookup --with-metadata)"`
 }
 
 func (r *UpdateCommand) Run(ctx context.Context, opts command.GlobalOptions) error {
@@ -24,45 +28,63 @@ func (r *UpdateCommand) Run(ctx context.Context, opts command.GlobalOptions) err
 	}
 	defer client.Close()
 
-	var keys datastore.Keys
-	var mutations []*datastore.Mutation
-	decoder := json.NewDecoder(opts.Stdin)
-	for {
-		var entity *datastore.Entity
-		if err := decoder.Decode(&entity); err == io.EOF {
-			break
-		} else if err != nil {
-			return err
-		}
-		keys = append(keys, entity.Key)
-		mutations = append(mutations, datastore.NewUpdate(entity.Key.ToDatastore(), entity))
+	source := newEntitySource(opts.Stdin, func(entity *datastore.Entity) *datastore.Mutation {
+		return datastore.NewUpdate(entity.Key.ToDatastore(), entity)
+	})
+	runner := &mutationRunner{
+		client:         client,
+		batchSize:      r.BatchSize,
+		parallelism:    r.Parallelism,
+		expectCount:    r.ExpectCount,
+		checkpoint:     r.Checkpoint,
+		silent:         r.Silent,
+		force:          r.Force,
+		dryRun:         r.DryRun,
+		stdout:         opts.Stdout,
+		askCommit:      !r.Force && !r.Commit,
+		operation:      "update",
+		confirmMessage: "Update these entities?",
 	}
-
-	// pre confirmation
-	if !r.Silent {
-		log.Printf("%d keys to update:", len(keys))
-		for _, key := range keys {
-			log.Println(key.String())
-		}
+	if !r.IfVersion {
+		return runner.run(ctx, source)
 	}
-	if !r.Force && !confirm("Update these entities?") {
-		return fmt.Errorf("aborted")
+	if r.DryRun {
+		return fmt.Errorf("--if-version cannot be used with --dry-run")
 	}
 
-	if _, err = client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
-		if _, err := tx.Mutate(mutations...); err != nil {
-			return fmt.Errorf("client.Mutate: %w", err)
+	var mu sync.Mutex
+	var conflicts int
+	llc := datastore.NewLowLevelClient(client)
+	runner.commitFunc = func(ctx context.Context, batch mutationBatch) error {
+		mutations := make([]*datastorepb.Mutation, len(batch.entities))
+		for i, entity := range batch.entities {
+			mutation, err := datastore.NewVersionedUpdate(entity)
+			if err != nil {
+				return err
+			}
+			mutations[i] = mutation
 		}
 
-		// post confirmation
-		if !r.Force && !r.Commit && !confirm("Commit?") {
-			return fmt.Errorf("aborted")
+		results, err := llc.Commit(ctx, mutations)
+		if err != nil {
+			return fmt.Errorf("llc.Commit: %w", err)
 		}
 
+		mu.Lock()
+		defer mu.Unlock()
+		for i, result := range results {
+			if result.GetConflictDetected() {
+				conflicts++
+				log.Printf("conflict: %s", batch.keys[i].String())
+			}
+		}
 		return nil
-	}); err != nil {
-		return fmt.Errorf("client.RunInTransaction: %w", err)
 	}
-
+	if err := runner.run(ctx, source); err != nil {
+		return err
+	}
+	if conflicts != 0 {
+		return fmt.Errorf("%d entities were not updated due to version conflicts", conflicts)
+	}
 	return nil
 }
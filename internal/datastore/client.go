@@ -6,10 +6,14 @@ import (
 	"os"
 	"reflect"
 	"slices"
+	"time"
 	"unsafe"
 
 	"cloud.google.com/go/datastore"
 	"cloud.google.com/go/datastore/apiv1/datastorepb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func NewClient(ctx context.Context, opts Options) (*datastore.Client, error) {
@@ -26,19 +30,37 @@ type LowLevelClient struct {
 	lc         datastorepb.DatastoreClient
 	dataset    string
 	databaseID string
+	readTime   time.Time
 }
 
 // NewLowLevelClient extracts the Datastore SDK's private client, dataset, and
 // databaseID fields. Metadata lookup needs those values, which the SDK does not
-// expose through its public API. Keep TestNewLowLevelClientSDKCompatibility in
-// sync with cloud.google.com/go/datastore upgrades.
+// expose through its public API. It also extracts the read time set by
+// WithReadTime to read the same snapshot as the SDK. Keep
+// TestNewLowLevelClientSDKCompatibility in sync with
+// cloud.google.com/go/datastore upgrades.
 func NewLowLevelClient(client *datastore.Client) *LowLevelClient {
 	pv := reflect.ValueOf(client)
 	sv := pv.Elem()
 	lc := extractPrivateField[datastorepb.DatastoreClient](sv, "client")
 	dataset := extractPrivateField[string](sv, "dataset")
 	databaseID := extractPrivateField[string](sv, "databaseID")
-	return &LowLevelClient{c: client, lc: lc, dataset: dataset, databaseID: databaseID}
+	readTime := extractPrivateField[time.Time](sv.FieldByName("readSettings").Elem(), "readTime")
+	return &LowLevelClient{c: client, lc: lc, dataset: dataset, databaseID: databaseID, readTime: readTime}
+}
+
+// WithReadTime makes the client read the snapshot of the database at the time (point-in-time recovery).
+// It applies to the low-level clients created from the client too.
+func WithReadTime(client *datastore.Client, t time.Time) *datastore.Client {
+	return client.WithReadOptions(datastore.ReadTime(t))
+}
+
+// readOptions returns the read options of the read time, or nil for the latest snapshot.
+func (c *LowLevelClient) readOptions() *datastorepb.ReadOptions {
+	if c.readTime.IsZero() {
+		return nil
+	}
+	return &datastorepb.ReadOptions{ConsistencyType: &datastorepb.ReadOptions_ReadTime{ReadTime: timestamppb.New(c.readTime)}}
 }
 
 func extractPrivateField[T any](sv reflect.Value, fieldName string) T {
@@ -49,9 +71,10 @@ func extractPrivateField[T any](sv reflect.Value, fieldName string) T {
 
 func (c *LowLevelClient) GetMetadata(ctx context.Context, key *datastore.Key) (*EntityMetadata, error) {
 	res, err := c.lc.Lookup(ctx, &datastorepb.LookupRequest{
-		ProjectId:  c.dataset,
-		DatabaseId: c.databaseID,
-		Keys:       []*datastorepb.Key{c.toLowLevelKey(key)},
+		ProjectId:   c.dataset,
+		DatabaseId:  c.databaseID,
+		Keys:        []*datastorepb.Key{c.toLowLevelKey(key)},
+		ReadOptions: c.readOptions(),
 	})
 	if err != nil {
 		return nil, err
@@ -72,6 +95,34 @@ func (c *LowLevelClient) GetMetadata(ctx context.Context, key *datastore.Key) (*
 	}, nil
 }
 
+// Lookup looks up the entity with its metadata, and returns nil if it does not exist.
+func (c *LowLevelClient) Lookup(ctx context.Context, key *datastore.Key) (*Entity, error) {
+	res, err := c.lc.Lookup(ctx, &datastorepb.LookupRequest{
+		ProjectId:   c.dataset,
+		DatabaseId:  c.databaseID,
+		Keys:        []*datastorepb.Key{c.toLowLevelKey(key)},
+		ReadOptions: c.readOptions(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.Deferred) != 0 {
+		return c.Lookup(ctx, key)
+	}
+	if len(res.Found) == 0 {
+		return nil, nil
+	}
+	return FromProtoEntityResult(res.Found[0]), nil
+}
+
+// WithReadTime returns a copy of the client reading the snapshot at the time.
+func (c *LowLevelClient) WithReadTime(t time.Time) *LowLevelClient {
+	cc := *c
+	cc.readTime = t
+	return &cc
+}
+
 func (c *LowLevelClient) toLowLevelKey(src *datastore.Key) *datastorepb.Key {
 	k := src
 	var path []*datastorepb.Key_PathElement
@@ -98,3 +149,159 @@ func (c *LowLevelClient) toLowLevelKey(src *datastore.Key) *datastorepb.Key {
 	}
 	return key
 }
+
+// Commit commits the mutations without a transaction and returns the results
+// for each mutation in the same order.
+func (c *LowLevelClient) Commit(ctx context.Context, mutations []*datastorepb.Mutation) ([]*datastorepb.MutationResult, error) {
+	res, err := c.lc.Commit(ctx, &datastorepb.CommitRequest{
+		ProjectId:  c.dataset,
+		DatabaseId: c.databaseID,
+		Mode:       datastorepb.CommitRequest_NON_TRANSACTIONAL,
+		Mutations:  mutations,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.MutationResults, nil
+}
+
+// NewVersionedUpdate creates an update mutation which conflicts unless the
+// current entity is at the version (or the update time) of the entity metadata.
+func NewVersionedUpdate(entity *Entity) (*datastorepb.Mutation, error) {
+	if entity.Metadata == nil {
+		return nil, fmt.Errorf("key=%s has no metadata", entity.Key.String())
+	}
+
+	pe, err := entity.ToProto()
+	if err != nil {
+		return nil, err
+	}
+	mutation := &datastorepb.Mutation{
+		Operation: &datastorepb.Mutation_Update{Update: pe},
+	}
+	switch {
+	case entity.Metadata.Version != 0:
+		mutation.ConflictDetectionStrategy = &datastorepb.Mutation_BaseVersion{BaseVersion: entity.Metadata.Version}
+	case !entity.Metadata.UpdateTime.IsZero():
+		mutation.ConflictDetectionStrategy = &datastorepb.Mutation_UpdateTime{UpdateTime: timestamppb.New(entity.Metadata.UpdateTime)}
+	default:
+		return nil, fmt.Errorf("key=%s has neither version nor update time in metadata", entity.Key.String())
+	}
+	return mutation, nil
+}
+
+// RunQuery runs the query in the namespace, and calls fn for each entity with its metadata and the cursor after it in order.
+// It fetches the next batches until the query finishes, and returns the cursor after the last result.
+func (c *LowLevelClient) RunQuery(ctx context.Context, namespace string, query *datastorepb.Query, fn func(entity *Entity, cursor []byte) error) ([]byte, error) {
+	query = proto.Clone(query).(*datastorepb.Query)
+	for {
+		res, err := c.lc.RunQuery(ctx, &datastorepb.RunQueryRequest{
+			ProjectId:   c.dataset,
+			DatabaseId:  c.databaseID,
+			PartitionId: &datastorepb.PartitionId{ProjectId: c.dataset, DatabaseId: c.databaseID, NamespaceId: namespace},
+			QueryType:   &datastorepb.RunQueryRequest_Query{Query: query},
+			ReadOptions: c.readOptions(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		batch := res.GetBatch()
+		for _, result := range batch.GetEntityResults() {
+			if err := fn(FromProtoEntityResult(result), result.GetCursor()); err != nil {
+				return nil, err
+			}
+		}
+		if batch.GetMoreResults() != datastorepb.QueryResultBatch_NOT_FINISHED {
+			return batch.GetEndCursor(), nil
+		}
+
+		// continue from the end of the batch
+		query.StartCursor = batch.GetEndCursor()
+		query.Offset -= batch.GetSkippedResults()
+		if query.Limit != nil {
+			query.Limit = wrapperspb.Int32(query.Limit.GetValue() - int32(len(batch.GetEntityResults())))
+		}
+	}
+}
+
+// RunAggregationQuery runs the aggregation query in the namespace, and returns the aggregated values by their aliases.
+// It supports aggregations the SDK does not support (e.g. COUNT_UP_TO).
+func (c *LowLevelClient) RunAggregationQuery(ctx context.Context, namespace string, query *datastorepb.AggregationQuery) (map[string]any, error) {
+	return c.runAggregationQuery(ctx, c.newAggregationQueryRequest(namespace, query))
+}
+
+// RunGQLAggregationQuery runs the aggregation query in GQL with literals and the bindings (nil for none) in the namespace,
+// and returns the aggregated values by their aliases.
+func (c *LowLevelClient) RunGQLAggregationQuery(ctx context.Context, namespace, gql string, bindings *GQLBindings) (map[string]any, error) {
+	req, err := c.newGQLAggregationQueryRequest(namespace, gql, bindings)
+	if err != nil {
+		return nil, err
+	}
+	return c.runAggregationQuery(ctx, req)
+}
+
+// ExplainAggregationQuery explains the aggregation query in the namespace.
+// The query is executed only if opts.Analyze is true.
+func (c *LowLevelClient) ExplainAggregationQuery(ctx context.Context, namespace string, query *datastorepb.AggregationQuery, opts ExplainOptions) (*ExplainMetrics, error) {
+	return c.explainAggregationQuery(ctx, c.newAggregationQueryRequest(namespace, query), opts)
+}
+
+// ExplainGQLAggregationQuery explains the aggregation query in GQL with literals and the bindings (nil for none) in the namespace.
+// The query is executed only if opts.Analyze is true.
+func (c *LowLevelClient) ExplainGQLAggregationQuery(ctx context.Context, namespace, gql string, bindings *GQLBindings, opts ExplainOptions) (*ExplainMetrics, error) {
+	req, err := c.newGQLAggregationQueryRequest(namespace, gql, bindings)
+	if err != nil {
+		return nil, err
+	}
+	return c.explainAggregationQuery(ctx, req, opts)
+}
+
+func (c *LowLevelClient) newAggregationQueryRequest(namespace string, query *datastorepb.AggregationQuery) *datastorepb.RunAggregationQueryRequest {
+	return &datastorepb.RunAggregationQueryRequest{
+		ProjectId:   c.dataset,
+		DatabaseId:  c.databaseID,
+		PartitionId: &datastorepb.PartitionId{ProjectId: c.dataset, DatabaseId: c.databaseID, NamespaceId: namespace},
+		QueryType:   &datastorepb.RunAggregationQueryRequest_AggregationQuery{AggregationQuery: query},
+		ReadOptions: c.readOptions(),
+	}
+}
+
+func (c *LowLevelClient) newGQLAggregationQueryRequest(namespace, gql string, bindings *GQLBindings) (*datastorepb.RunAggregationQueryRequest, error) {
+	positional, named, err := bindings.toProto()
+	if err != nil {
+		return nil, err
+	}
+	query := &datastorepb.GqlQuery{QueryString: gql, AllowLiterals: true, PositionalBindings: positional, NamedBindings: named}
+	return &datastorepb.RunAggregationQueryRequest{
+		ProjectId:   c.dataset,
+		DatabaseId:  c.databaseID,
+		PartitionId: &datastorepb.PartitionId{ProjectId: c.dataset, DatabaseId: c.databaseID, NamespaceId: namespace},
+		QueryType:   &datastorepb.RunAggregationQueryRequest_GqlQuery{GqlQuery: query},
+		ReadOptions: c.readOptions(),
+	}, nil
+}
+
+func (c *LowLevelClient) runAggregationQuery(ctx context.Context, req *datastorepb.RunAggregationQueryRequest) (map[string]any, error) {
+	res, err := c.lc.RunAggregationQuery(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]any{}
+	for _, r := range res.GetBatch().GetAggregationResults() {
+		for alias, value := range r.GetAggregateProperties() {
+			result[alias] = value
+		}
+	}
+	return result, nil
+}
+
+func (c *LowLevelClient) explainAggregationQuery(ctx context.Context, req *datastorepb.RunAggregationQueryRequest, opts ExplainOptions) (*ExplainMetrics, error) {
+	req.ExplainOptions = &datastorepb.ExplainOptions{Analyze: opts.Analyze}
+	res, err := c.lc.RunAggregationQuery(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return fromProtoExplainMetrics(res.GetExplainMetrics()), nil
+}
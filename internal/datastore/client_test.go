@@ -2,6 +2,7 @@ package datastore
 
 import (
 	"testing"
+	"time"
 
 	clouddatastore "cloud.google.com/go/datastore"
 	"google.golang.org/api/option"
@@ -41,4 +42,13 @@ func TestNewLowLevelClientSDKCompatibility(t *testing.T) {
 	if got := lowLevelClient.databaseID; got != databaseID {
 		t.Errorf("databaseID = %q, want %q", got, databaseID)
 	}
+	if got := lowLevelClient.readOptions(); got != nil {
+		t.Errorf("readOptions() = %v, want nil", got)
+	}
+
+	readTime := time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)
+	lowLevelClient = NewLowLevelClient(WithReadTime(client, readTime))
+	if got := lowLevelClient.readOptions().GetReadTime().AsTime(); !got.Equal(readTime) {
+		t.Errorf("read time = %v, want %v", got, readTime)
+	}
 }
@@ -0,0 +1,92 @@
+package datastore
+
+import (
+	"bytes"
+	"cmp"
+	"slices"
+	"time"
+)
+
+// PropertyDiff is a difference of a property between two entities.
+// Before is nil for an added property, and After is nil for a removed property.
+type PropertyDiff struct {
+	Name   string    `json:"name"`
+	Before *Property `json:"before,omitempty"`
+	After  *Property `json:"after,omitempty"`
+}
+
+// DiffProperties compares properties by name and returns the differences sorted by name.
+// A property is changed if its value or noIndex flag is different.
+func DiffProperties(before, after []Property) []PropertyDiff {
+	beforeMap := make(map[string]*Property, len(before))
+	for i := range before {
+		beforeMap[before[i].Name] = &before[i]
+	}
+	afterMap := make(map[string]*Property, len(after))
+	for i := range after {
+		afterMap[after[i].Name] = &after[i]
+	}
+
+	var diffs []PropertyDiff
+	for name, b := range beforeMap {
+		a, ok := afterMap[name]
+		if !ok {
+			diffs = append(diffs, PropertyDiff{Name: name, Before: b})
+		} else if b.NoIndex != a.NoIndex || !b.Value.Equal(&a.Value) {
+			diffs = append(diffs, PropertyDiff{Name: name, Before: b, After: a})
+		}
+	}
+	for name, a := range afterMap {
+		if _, ok := beforeMap[name]; !ok {
+			diffs = append(diffs, PropertyDiff{Name: name, After: a})
+		}
+	}
+	slices.SortFunc(diffs, func(lhs, rhs PropertyDiff) int {
+		return cmp.Compare(lhs.Name, rhs.Name)
+	})
+	return diffs
+}
+
+// Equal reports whether the values are the same as values stored in datastore.
+func (v *Value) Equal(o *Value) bool {
+	if v.Type != o.Type {
+		return false
+	}
+
+	switch v.Type {
+	case ArrayType:
+		lhs, rhs := v.Value.([]Value), o.Value.([]Value)
+		return slices.EqualFunc(lhs, rhs, func(lhs, rhs Value) bool {
+			return lhs.Equal(&rhs)
+		})
+
+	case BlobType:
+		return bytes.Equal(v.Value.([]byte), o.Value.([]byte))
+
+	case TimestampType:
+		// datastore stores timestamps in microseconds precision
+		lhs, rhs := v.Value.(time.Time), o.Value.(time.Time)
+		return lhs.Truncate(time.Microsecond).Equal(rhs.Truncate(time.Microsecond))
+
+	case EntityType:
+		lhs, rhs := toEmbeddedEntity(v.Value), toEmbeddedEntity(o.Value)
+		return lhs.Key.Equal(rhs.Key) && len(lhs.Properties) == len(rhs.Properties) && len(DiffProperties(lhs.Properties, rhs.Properties)) == 0
+
+	case KeyType:
+		return v.Value.(*Key).Equal(o.Value.(*Key))
+
+	default:
+		return v.Value == o.Value
+	}
+}
+
+func toEmbeddedEntity(v any) EmbeddedEntity {
+	switch v := v.(type) {
+	case []Property:
+		return EmbeddedEntity{Properties: v}
+	case EmbeddedEntity:
+		return v
+	default:
+		panic("unexpected entity value type")
+	}
+}
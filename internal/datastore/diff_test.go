@@ -0,0 +1,64 @@
+package datastore
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffProperties(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+	before := []Property{
+		{Name: "unchanged", Value: Value{Type: IntType, Value: int64(1)}},
+		{Name: "changed", Value: Value{Type: StringType, Value: "foo"}},
+		{Name: "noIndex", Value: Value{Type: StringType, Value: "foo"}},
+		{Name: "removed", Value: Value{Type: BoolType, Value: true}},
+		{Name: "timestamp", Value: Value{Type: TimestampType, Value: ts}},
+		{Name: "array", Value: Value{Type: ArrayType, Value: []Value{{Type: IntType, Value: int64(1)}}}},
+		{Name: "entity", Value: Value{Type: EntityType, Value: []Property{
+			{Name: "a", Value: Value{Type: IntType, Value: int64(1)}},
+			{Name: "b", Value: Value{Type: KeyType, Value: &Key{Kind: "Foo", Name: "foo"}}},
+		}}},
+	}
+	after := []Property{
+		{Name: "unchanged", Value: Value{Type: IntType, Value: int64(1)}},
+		{Name: "changed", Value: Value{Type: StringType, Value: "bar"}},
+		{Name: "noIndex", Value: Value{Type: StringType, Value: "foo"}, NoIndex: true},
+		{Name: "added", Value: Value{Type: NullType}},
+		{Name: "timestamp", Value: Value{Type: TimestampType, Value: ts.Add(500).In(time.FixedZone("JST", 9*60*60))}},
+		{Name: "array", Value: Value{Type: ArrayType, Value: []Value{{Type: IntType, Value: int64(1)}, {Type: IntType, Value: int64(2)}}}},
+		{Name: "entity", Value: Value{Type: EntityType, Value: EmbeddedEntity{Properties: []Property{
+			{Name: "b", Value: Value{Type: KeyType, Value: &Key{Kind: "Foo", Name: "foo"}}},
+			{Name: "a", Value: Value{Type: IntType, Value: int64(1)}},
+		}}}},
+	}
+
+	var names []string
+	for _, diff := range DiffProperties(before, after) {
+		names = append(names, diff.Name)
+	}
+	if diff := cmp.Diff([]string{"added", "array", "changed", "noIndex", "removed"}, names); diff != "" {
+		t.Errorf("unexpected changed properties (-want +got):\n%s", diff)
+	}
+}
+
+func TestDiffProperties_JSON(t *testing.T) {
+	t.Parallel()
+
+	diffs := DiffProperties(
+		[]Property{{Name: "p", Value: Value{Type: IntType, Value: int64(1)}}},
+		[]Property{{Name: "p", Value: Value{Type: IntType, Value: int64(2)}}},
+	)
+	got, err := json.Marshal(diffs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"name":"p","before":{"type":"int","value":1,"name":"p"},"after":{"type":"int","value":2,"name":"p"}}]`
+	if string(got) != want {
+		t.Errorf("JSON = %s, want %s", got, want)
+	}
+}
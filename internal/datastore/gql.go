@@ -0,0 +1,36 @@
+package datastore
+
+import (
+	"cloud.google.com/go/datastore/apiv1/datastorepb"
+)
+
+// GQLBindings are the values of the binding sites in GQL: @1, @2, ... by Positional and @name by Named.
+type GQLBindings struct {
+	Positional []Value
+	Named      map[string]Value
+}
+
+// toProto converts the bindings to the parameters of the low-level GQL query.
+func (b *GQLBindings) toProto() ([]*datastorepb.GqlQueryParameter, map[string]*datastorepb.GqlQueryParameter, error) {
+	if b == nil {
+		return nil, nil, nil
+	}
+
+	positional := make([]*datastorepb.GqlQueryParameter, len(b.Positional))
+	for i, v := range b.Positional {
+		value, err := v.toProto(false)
+		if err != nil {
+			return nil, nil, err
+		}
+		positional[i] = &datastorepb.GqlQueryParameter{ParameterType: &datastorepb.GqlQueryParameter_Value{Value: value}}
+	}
+	named := make(map[string]*datastorepb.GqlQueryParameter, len(b.Named))
+	for name, v := range b.Named {
+		value, err := v.toProto(false)
+		if err != nil {
+			return nil, nil, err
+		}
+		named[name] = &datastorepb.GqlQueryParameter{ParameterType: &datastorepb.GqlQueryParameter_Value{Value: value}}
+	}
+	return positional, named, nil
+}
@@ -1,6 +1,7 @@
 package datastore
 
 import (
+	"cmp"
 	"net/url"
 	"slices"
 	"strconv"
@@ -32,27 +33,86 @@ func (k *Key) ToDatastore() *datastore.Key {
 	return key
 }
 
-func (k *Key) ToProto() *datastorepb.Key {
-	root := k
-	keys := []*Key{root}
-	for root.Parent != nil {
-		root = root.Parent
-		keys = append(keys, root)
+// WithNamespace returns a copy of the key and its ancestors in the namespace.
+func (k *Key) WithNamespace(namespace string) *Key {
+	if k == nil {
+		return nil
+	}
+	key := *k
+	key.Namespace = namespace
+	key.Parent = k.Parent.WithNamespace(namespace)
+	return &key
+}
+
+// Equal reports whether the keys point to the same entity. Nil keys are equal to each other.
+func (k *Key) Equal(o *Key) bool {
+	if k == nil || o == nil {
+		return k == o
+	}
+	return k.Kind == o.Kind && k.ID == o.ID && k.Name == o.Name && k.Namespace == o.Namespace && k.Parent.Equal(o.Parent)
+}
+
+// Incomplete reports whether the key has neither ID nor name. Datastore assigns an ID to it on insert.
+func (k *Key) Incomplete() bool {
+	return k.ID == 0 && k.Name == ""
+}
+
+// Compare compares the keys in the order of Datastore: path elements are compared from the root
+// by kind and then by ID or name (IDs come before names), and an ancestor comes before its descendants.
+// Namespaces are not compared because a query never spans namespaces.
+func (k *Key) Compare(o *Key) int {
+	kp, op := k.path(), o.path()
+	for i := range min(len(kp), len(op)) {
+		a, b := kp[i], op[i]
+		if c := strings.Compare(a.Kind, b.Kind); c != 0 {
+			return c
+		}
+		switch {
+		case a.Name == "" && b.Name == "":
+			if c := cmp.Compare(a.ID, b.ID); c != 0 {
+				return c
+			}
+		case a.Name == "":
+			return -1
+		case b.Name == "":
+			return 1
+		default:
+			if c := strings.Compare(a.Name, b.Name); c != 0 {
+				return c
+			}
+		}
+	}
+	return cmp.Compare(len(kp), len(op))
+}
+
+// path returns the keys from the root to the key.
+func (k *Key) path() []*Key {
+	var keys []*Key
+	for key := k; key != nil; key = key.Parent {
+		keys = append(keys, key)
 	}
 	slices.Reverse(keys)
+	return keys
+}
 
+func (k *Key) ToProto() *datastorepb.Key {
+	keys := k.path()
 	path := make([]*datastorepb.Key_PathElement, len(keys))
 	for i, k := range keys {
-		if k.Name != "" {
+		switch {
+		case k.Name != "":
 			path[i] = &datastorepb.Key_PathElement{
 				Kind:   k.Kind,
 				IdType: &datastorepb.Key_PathElement_Name{Name: k.Name},
 			}
-		} else {
+		case k.ID != 0:
 			path[i] = &datastorepb.Key_PathElement{
 				Kind:   k.Kind,
 				IdType: &datastorepb.Key_PathElement_Id{Id: k.ID},
 			}
+		default:
+			// incomplete key
+			path[i] = &datastorepb.Key_PathElement{Kind: k.Kind}
 		}
 	}
 
@@ -0,0 +1,76 @@
+package datastore
+
+import (
+	"testing"
+
+	"cloud.google.com/go/datastore/apiv1/datastorepb"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+)
+
+func TestKeyToProto_Incomplete(t *testing.T) {
+	t.Parallel()
+
+	key := &Key{Kind: "Child", Parent: &Key{Kind: "Parent", ID: 1, Namespace: "ns"}, Namespace: "ns"}
+	if !key.Incomplete() {
+		t.Error("key should be incomplete")
+	}
+	if key.Parent.Incomplete() {
+		t.Error("parent key should be complete")
+	}
+
+	want := &datastorepb.Key{
+		PartitionId: &datastorepb.PartitionId{NamespaceId: "ns"},
+		Path: []*datastorepb.Key_PathElement{
+			{Kind: "Parent", IdType: &datastorepb.Key_PathElement_Id{Id: 1}},
+			{Kind: "Child"},
+		},
+	}
+	if diff := cmp.Diff(want, key.ToProto(), protocmp.Transform()); diff != "" {
+		t.Errorf("unexpected key (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(key, FromProtoKey(want)); diff != "" {
+		t.Errorf("unexpected round trip (-want +got):\n%s", diff)
+	}
+}
+
+func TestKeyCompare(t *testing.T) {
+	t.Parallel()
+
+	parent := &Key{Kind: "A", ID: 1}
+	// sorted in Datastore key order
+	keys := []*Key{
+		{Kind: "A", ID: 1},
+		{Kind: "B", ID: 1, Parent: parent},
+		{Kind: "B", Name: "a", Parent: parent},
+		{Kind: "A", ID: 2},
+		{Kind: "A", ID: 10},
+		{Kind: "A", Name: "1"},
+		{Kind: "A", Name: "a"},
+		{Kind: "A", Name: "b"},
+		{Kind: "B", ID: 1},
+	}
+	for i, a := range keys {
+		for j, b := range keys {
+			got := a.Compare(b)
+			switch {
+			case i < j && got >= 0, i > j && got <= 0, i == j && got != 0:
+				t.Errorf("%s.Compare(%s) = %d", a.String(), b.String(), got)
+			}
+		}
+	}
+}
+
+func TestKeyWithNamespace(t *testing.T) {
+	t.Parallel()
+
+	key := &Key{Kind: "Child", ID: 1, Namespace: "a", Parent: &Key{Kind: "Parent", Name: "p", Namespace: "a"}}
+	got := key.WithNamespace("b")
+	want := &Key{Kind: "Child", ID: 1, Namespace: "b", Parent: &Key{Kind: "Parent", Name: "p", Namespace: "b"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected key (-want +got):\n%s", diff)
+	}
+	if key.Namespace != "a" || key.Parent.Namespace != "a" {
+		t.Errorf("the original key is modified: %v", key)
+	}
+}
@@ -0,0 +1,51 @@
+package datastore
+
+import (
+	"fmt"
+	"slices"
+)
+
+// EntityPatch is a partial property set to merge into an existing entity.
+type EntityPatch struct {
+	Key        *Key       `json:"key"`
+	Properties []Property `json:"properties,omitempty"`
+	Remove     []string   `json:"remove,omitempty"`
+}
+
+// Apply merges the patch into the properties and returns the merged properties.
+// Properties in the patch replace the properties of the same name (including their noIndex flags)
+// or are appended, and properties named in Remove are removed.
+// Other properties are kept as they are.
+func (p *EntityPatch) Apply(props []Property) ([]Property, error) {
+	patched := make(map[string]int, len(p.Properties))
+	for i, prop := range p.Properties {
+		if _, ok := patched[prop.Name]; ok {
+			return nil, fmt.Errorf("duplicate property: %s", prop.Name)
+		}
+		patched[prop.Name] = i
+	}
+	for _, name := range p.Remove {
+		if _, ok := patched[name]; ok {
+			return nil, fmt.Errorf("property %s is both set and removed", name)
+		}
+	}
+
+	merged := make([]Property, 0, len(props)+len(p.Properties))
+	for _, prop := range props {
+		if slices.Contains(p.Remove, prop.Name) {
+			continue
+		}
+		if i, ok := patched[prop.Name]; ok {
+			merged = append(merged, p.Properties[i])
+			delete(patched, prop.Name)
+			continue
+		}
+		merged = append(merged, prop)
+	}
+	for _, prop := range p.Properties {
+		if _, ok := patched[prop.Name]; ok {
+			merged = append(merged, prop)
+		}
+	}
+	return merged, nil
+}
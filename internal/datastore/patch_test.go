@@ -0,0 +1,73 @@
+package datastore
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEntityPatchApply(t *testing.T) {
+	t.Parallel()
+
+	props := []Property{
+		{Name: "keep", Value: Value{Type: StringType, Value: "foo"}, NoIndex: true},
+		{Name: "replace", Value: Value{Type: IntType, Value: int64(1)}, NoIndex: true},
+		{Name: "remove", Value: Value{Type: BoolType, Value: true}},
+	}
+	patch := &EntityPatch{
+		Properties: []Property{
+			{Name: "add", Value: Value{Type: NullType}},
+			{Name: "replace", Value: Value{Type: IntType, Value: int64(2)}},
+		},
+		Remove: []string{"remove", "nonexistent"},
+	}
+
+	got, err := patch.Apply(props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Property{
+		{Name: "keep", Value: Value{Type: StringType, Value: "foo"}, NoIndex: true},
+		{Name: "replace", Value: Value{Type: IntType, Value: int64(2)}},
+		{Name: "add", Value: Value{Type: NullType}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected properties (-want +got):\n%s", diff)
+	}
+	if len(props) != 3 || props[2].Name != "remove" {
+		t.Errorf("original properties are modified: %v", props)
+	}
+}
+
+func TestEntityPatchApply_Error(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		patch *EntityPatch
+	}{
+		{
+			name: "duplicate",
+			patch: &EntityPatch{Properties: []Property{
+				{Name: "p", Value: Value{Type: NullType}},
+				{Name: "p", Value: Value{Type: NullType}},
+			}},
+		},
+		{
+			name: "set and removed",
+			patch: &EntityPatch{
+				Properties: []Property{{Name: "p", Value: Value{Type: NullType}}},
+				Remove:     []string{"p"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := tt.patch.Apply(nil); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
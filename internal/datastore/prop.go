@@ -3,6 +3,8 @@ package datastore
 import (
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
 
 	"cloud.google.com/go/datastore"
 	"cloud.google.com/go/datastore/apiv1/datastorepb"
@@ -27,6 +29,7 @@ func NewPropertiesByProtoValueMap(m map[string]any) []Property {
 
 		props = append(props, prop)
 	}
+	slices.SortFunc(props, func(a, b Property) int { return strings.Compare(a.Name, b.Name) })
 	return props
 }
 
@@ -38,7 +41,7 @@ func (p *Property) fromDatastoreProperty(prop datastore.Property) {
 
 func (p *Property) toDatastoreProperty() (prop datastore.Property) {
 	prop.Name = p.Name
-	prop.Value = p.Value.toDatastoreValue()
+	prop.Value = p.Value.ToDatastoreValue()
 	prop.NoIndex = p.NoIndex
 	return
 }
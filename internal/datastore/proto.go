@@ -0,0 +1,264 @@
+package datastore
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore/apiv1/datastorepb"
+	"google.golang.org/genproto/googleapis/type/latlng"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ToProto converts the entity to the low-level API representation.
+func (e *Entity) ToProto() (*datastorepb.Entity, error) {
+	var key *datastorepb.Key
+	if e.Key != nil {
+		key = e.Key.ToProto()
+	}
+	return propertiesToProto(key, e.Properties)
+}
+
+// FromProtoEntity converts the low-level API representation of the entity.
+func FromProtoEntity(src *datastorepb.Entity) *Entity {
+	entity := &Entity{Properties: propertiesFromProto(src.GetProperties())}
+	if key := src.GetKey(); key != nil {
+		entity.Key = FromProtoKey(key)
+	}
+	return entity
+}
+
+// FromProtoEntityResult converts the entity of the low-level query result with its metadata.
+func FromProtoEntityResult(src *datastorepb.EntityResult) *Entity {
+	entity := FromProtoEntity(src.GetEntity())
+	entity.Metadata = &EntityMetadata{
+		Version:    src.GetVersion(),
+		CreateTime: src.GetCreateTime().AsTime(),
+		UpdateTime: src.GetUpdateTime().AsTime(),
+	}
+	return entity
+}
+
+// propertiesFromProto converts the properties ordered by their names because the map order is random.
+func propertiesFromProto(src map[string]*datastorepb.Value) []Property {
+	props := make([]Property, 0, len(src))
+	for name, value := range src {
+		prop := Property{Name: name, NoIndex: value.GetExcludeFromIndexes()}
+		if values := value.GetArrayValue().GetValues(); len(values) != 0 {
+			// array values have exclude_from_indexes on their elements instead of themselves
+			prop.NoIndex = values[0].GetExcludeFromIndexes()
+		}
+		prop.Value.fromDatastoreProtoValue(value)
+		props = append(props, prop)
+	}
+	slices.SortFunc(props, func(a, b Property) int { return strings.Compare(a.Name, b.Name) })
+	return props
+}
+
+func propertiesToProto(key *datastorepb.Key, props []Property) (*datastorepb.Entity, error) {
+	dest := &datastorepb.Entity{
+		Key:        key,
+		Properties: make(map[string]*datastorepb.Value, len(props)),
+	}
+	for _, prop := range props {
+		if _, ok := dest.Properties[prop.Name]; ok {
+			return nil, fmt.Errorf("duplicate property: %s", prop.Name)
+		}
+
+		v, err := prop.Value.toProto(prop.NoIndex)
+		if err != nil {
+			return nil, fmt.Errorf("property %s: %w", prop.Name, err)
+		}
+		dest.Properties[prop.Name] = v
+	}
+	return dest, nil
+}
+
+func (v *Value) toProto(noIndex bool) (*datastorepb.Value, error) {
+	dest := &datastorepb.Value{ExcludeFromIndexes: noIndex}
+	switch v.Type {
+	case ArrayType:
+		src := v.Value.([]Value)
+		values := make([]*datastorepb.Value, len(src))
+		for i, v := range src {
+			value, err := v.toProto(noIndex)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		dest.ValueType = &datastorepb.Value_ArrayValue{ArrayValue: &datastorepb.ArrayValue{Values: values}}
+		// array values have exclude_from_indexes on their elements instead of themselves
+		dest.ExcludeFromIndexes = false
+
+	case BlobType:
+		dest.ValueType = &datastorepb.Value_BlobValue{BlobValue: v.Value.([]byte)}
+
+	case BoolType:
+		dest.ValueType = &datastorepb.Value_BooleanValue{BooleanValue: v.Value.(bool)}
+
+	case TimestampType:
+		dest.ValueType = &datastorepb.Value_TimestampValue{TimestampValue: timestamppb.New(v.Value.(time.Time))}
+
+	case EntityType:
+		var key *datastorepb.Key
+		var properties []Property
+		switch src := v.Value.(type) {
+		case []Property:
+			properties = src
+		case EmbeddedEntity:
+			properties = src.Properties
+			if src.Key != nil {
+				key = src.Key.ToProto()
+			}
+		default:
+			panic(fmt.Sprintf("unexpected entity value type: %T", v.Value))
+		}
+		entity, err := propertiesToProto(key, properties)
+		if err != nil {
+			return nil, err
+		}
+		dest.ValueType = &datastorepb.Value_EntityValue{EntityValue: entity}
+
+	case FloatType:
+		dest.ValueType = &datastorepb.Value_DoubleValue{DoubleValue: v.Value.(float64)}
+
+	case GeoPointType:
+		src := v.Value.(GeoPoint)
+		dest.ValueType = &datastorepb.Value_GeoPointValue{GeoPointValue: &latlng.LatLng{Latitude: src.Lat, Longitude: src.Lng}}
+
+	case IntType:
+		dest.ValueType = &datastorepb.Value_IntegerValue{IntegerValue: v.Value.(int64)}
+
+	case KeyType:
+		dest.ValueType = &datastorepb.Value_KeyValue{KeyValue: v.Value.(*Key).ToProto()}
+
+	case NullType:
+		dest.ValueType = &datastorepb.Value_NullValue{NullValue: structpb.NullValue_NULL_VALUE}
+
+	case StringType:
+		dest.ValueType = &datastorepb.Value_StringValue{StringValue: v.Value.(string)}
+
+	default:
+		return nil, fmt.Errorf("unknown type: %s", v.Type)
+	}
+	return dest, nil
+}
+
+// FilterToProto converts the entity filter to the low-level API representation.
+func FilterToProto(filter EntityFilter) (*datastorepb.Filter, error) {
+	switch f := filter.(type) {
+	case PropertyFilter:
+		op, ok := propertyFilterOperators[f.Operator]
+		if !ok {
+			return nil, fmt.Errorf("unknown operator: %s", f.Operator)
+		}
+		var value Value
+		value.fromDatastoreValue(f.Value)
+		v, err := value.toProto(false)
+		if err != nil {
+			return nil, fmt.Errorf("property %s: %w", f.FieldName, err)
+		}
+		return &datastorepb.Filter{FilterType: &datastorepb.Filter_PropertyFilter{PropertyFilter: &datastorepb.PropertyFilter{
+			Property: &datastorepb.PropertyReference{Name: f.FieldName},
+			Op:       op,
+			Value:    v,
+		}}}, nil
+	case AndFilter:
+		return compositeFilterToProto(datastorepb.CompositeFilter_AND, f.Filters)
+	case OrFilter:
+		return compositeFilterToProto(datastorepb.CompositeFilter_OR, f.Filters)
+	default:
+		return nil, fmt.Errorf("unknown filter: %T", filter)
+	}
+}
+
+var propertyFilterOperators = map[string]datastorepb.PropertyFilter_Operator{
+	"=":      datastorepb.PropertyFilter_EQUAL,
+	"!=":     datastorepb.PropertyFilter_NOT_EQUAL,
+	"<":      datastorepb.PropertyFilter_LESS_THAN,
+	"<=":     datastorepb.PropertyFilter_LESS_THAN_OR_EQUAL,
+	">":      datastorepb.PropertyFilter_GREATER_THAN,
+	">=":     datastorepb.PropertyFilter_GREATER_THAN_OR_EQUAL,
+	"in":     datastorepb.PropertyFilter_IN,
+	"not-in": datastorepb.PropertyFilter_NOT_IN,
+}
+
+func compositeFilterToProto(op datastorepb.CompositeFilter_Operator, filters []EntityFilter) (*datastorepb.Filter, error) {
+	dest := make([]*datastorepb.Filter, len(filters))
+	for i, filter := range filters {
+		f, err := FilterToProto(filter)
+		if err != nil {
+			return nil, err
+		}
+		dest[i] = f
+	}
+	return &datastorepb.Filter{FilterType: &datastorepb.Filter_CompositeFilter{CompositeFilter: &datastorepb.CompositeFilter{
+		Op:      op,
+		Filters: dest,
+	}}}, nil
+}
+
+// NewProtoQuery creates a low-level query of the kind filtered by the ancestor and the filter (both are optional).
+func NewProtoQuery(kind string, ancestor *Key, filter EntityFilter) (*datastorepb.Query, error) {
+	query := &datastorepb.Query{}
+	if kind != "" {
+		query.Kind = []*datastorepb.KindExpression{{Name: kind}}
+	}
+
+	var filters []*datastorepb.Filter
+	if ancestor != nil {
+		filters = append(filters, &datastorepb.Filter{FilterType: &datastorepb.Filter_PropertyFilter{PropertyFilter: &datastorepb.PropertyFilter{
+			Property: &datastorepb.PropertyReference{Name: "__key__"},
+			Op:       datastorepb.PropertyFilter_HAS_ANCESTOR,
+			Value:    &datastorepb.Value{ValueType: &datastorepb.Value_KeyValue{KeyValue: ancestor.ToProto()}},
+		}}})
+	}
+	if filter != nil {
+		f, err := FilterToProto(filter)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	switch len(filters) {
+	case 0:
+	case 1:
+		query.Filter = filters[0]
+	default:
+		query.Filter = &datastorepb.Filter{FilterType: &datastorepb.Filter_CompositeFilter{CompositeFilter: &datastorepb.CompositeFilter{
+			Op:      datastorepb.CompositeFilter_AND,
+			Filters: filters,
+		}}}
+	}
+	return query, nil
+}
+
+// fromProtoExplainMetrics converts the low-level API representation of explain metrics like the SDK.
+func fromProtoExplainMetrics(src *datastorepb.ExplainMetrics) *ExplainMetrics {
+	if src == nil {
+		return nil
+	}
+
+	dest := &ExplainMetrics{}
+	if planSummary := src.GetPlanSummary(); planSummary != nil {
+		dest.PlanSummary = &PlanSummary{IndexesUsed: []*map[string]any{}}
+		for _, indexUsed := range planSummary.GetIndexesUsed() {
+			m := indexUsed.AsMap()
+			dest.PlanSummary.IndexesUsed = append(dest.PlanSummary.IndexesUsed, &m)
+		}
+	}
+	if stats := src.GetExecutionStats(); stats != nil {
+		executionDuration := stats.GetExecutionDuration().AsDuration()
+		debugStats := stats.GetDebugStats().AsMap()
+		dest.ExecutionStats = &ExecutionStats{
+			ResultsReturned:   stats.GetResultsReturned(),
+			ExecutionDuration: &executionDuration,
+			ReadOperations:    stats.GetReadOperations(),
+			DebugStats:        &debugStats,
+		}
+	}
+	return dest
+}
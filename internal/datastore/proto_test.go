@@ -0,0 +1,279 @@
+package datastore
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore/apiv1/datastorepb"
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/testing/protocmp"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestEntityToProto(t *testing.T) {
+	t.Parallel()
+
+	key := &Key{Kind: "Task", Name: "foo"}
+	entity := &Entity{Key: key, Properties: []Property{
+		{Name: "int", Value: Value{Type: IntType, Value: int64(1)}},
+		{Name: "text", Value: Value{Type: StringType, Value: "foo"}, NoIndex: true},
+		{Name: "null", Value: Value{Type: NullType}},
+		{Name: "array", Value: Value{Type: ArrayType, Value: []Value{{Type: BoolType, Value: true}}}, NoIndex: true},
+		{Name: "entity", Value: Value{Type: EntityType, Value: []Property{
+			{Name: "a", Value: Value{Type: FloatType, Value: 1.5}},
+		}}},
+	}}
+
+	got, err := entity.ToProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &datastorepb.Entity{
+		Key: key.ToProto(),
+		Properties: map[string]*datastorepb.Value{
+			"int":  {ValueType: &datastorepb.Value_IntegerValue{IntegerValue: 1}},
+			"text": {ValueType: &datastorepb.Value_StringValue{StringValue: "foo"}, ExcludeFromIndexes: true},
+			"null": {ValueType: &datastorepb.Value_NullValue{NullValue: structpb.NullValue_NULL_VALUE}},
+			"array": {ValueType: &datastorepb.Value_ArrayValue{ArrayValue: &datastorepb.ArrayValue{Values: []*datastorepb.Value{
+				{ValueType: &datastorepb.Value_BooleanValue{BooleanValue: true}, ExcludeFromIndexes: true},
+			}}}},
+			"entity": {ValueType: &datastorepb.Value_EntityValue{EntityValue: &datastorepb.Entity{
+				Properties: map[string]*datastorepb.Value{
+					"a": {ValueType: &datastorepb.Value_DoubleValue{DoubleValue: 1.5}},
+				},
+			}}},
+		},
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("unexpected entity (-want +got):\n%s", diff)
+	}
+
+	entity.Properties = append(entity.Properties, Property{Name: "int", Value: Value{Type: IntType, Value: int64(2)}})
+	if _, err := entity.ToProto(); err == nil {
+		t.Error("expected an error for duplicate properties")
+	}
+}
+
+func TestFromProtoEntityResult(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	key := &Key{Kind: "Task", Name: "foo"}
+	want := &Entity{Key: key, Properties: []Property{
+		{Name: "array", Value: Value{Type: ArrayType, Value: []Value{{Type: BoolType, Value: true}}}, NoIndex: true},
+		{Name: "blob", Value: Value{Type: BlobType, Value: []byte("foo")}, NoIndex: true},
+		{Name: "embedded", Value: Value{Type: EntityType, Value: EmbeddedEntity{Key: &Key{Kind: "Child", ID: 1}, Properties: []Property{
+			{Name: "b", Value: Value{Type: KeyType, Value: &Key{Kind: "Other", ID: 2}}},
+		}}}},
+		{Name: "entity", Value: Value{Type: EntityType, Value: []Property{
+			{Name: "a", Value: Value{Type: FloatType, Value: 1.5}},
+		}}},
+		{Name: "geo", Value: Value{Type: GeoPointType, Value: GeoPoint{Lat: 1, Lng: 2}}},
+		{Name: "int", Value: Value{Type: IntType, Value: int64(1)}},
+		{Name: "null", Value: Value{Type: NullType}},
+		{Name: "text", Value: Value{Type: StringType, Value: "foo"}},
+		{Name: "time", Value: Value{Type: TimestampType, Value: now}},
+	}, Metadata: &EntityMetadata{Version: 3, CreateTime: now, UpdateTime: now.Add(time.Hour)}}
+
+	pb, err := want.ToProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := FromProtoEntityResult(&datastorepb.EntityResult{
+		Entity:     pb,
+		Version:    3,
+		CreateTime: timestamppb.New(now),
+		UpdateTime: timestamppb.New(now.Add(time.Hour)),
+	})
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected entity (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewVersionedUpdate(t *testing.T) {
+	t.Parallel()
+
+	key := &Key{Kind: "Task", Name: "foo"}
+	updateTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		metadata *EntityMetadata
+		want     *datastorepb.Mutation
+		wantErr  bool
+	}{
+		{
+			name:     "version",
+			metadata: &EntityMetadata{Version: 42, UpdateTime: updateTime},
+			want:     &datastorepb.Mutation{ConflictDetectionStrategy: &datastorepb.Mutation_BaseVersion{BaseVersion: 42}},
+		},
+		{
+			name:     "update time",
+			metadata: &EntityMetadata{UpdateTime: updateTime},
+			want:     &datastorepb.Mutation{ConflictDetectionStrategy: &datastorepb.Mutation_UpdateTime{UpdateTime: timestamppb.New(updateTime)}},
+		},
+		{
+			name:     "empty metadata",
+			metadata: &EntityMetadata{},
+			wantErr:  true,
+		},
+		{
+			name:    "no metadata",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := NewVersionedUpdate(&Entity{Key: key, Metadata: tt.metadata})
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected an error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.want.Operation = &datastorepb.Mutation_Update{Update: &datastorepb.Entity{Key: key.ToProto(), Properties: map[string]*datastorepb.Value{}}}
+			if diff := cmp.Diff(tt.want, got, protocmp.Transform()); diff != "" {
+				t.Errorf("unexpected mutation (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewProtoQuery(t *testing.T) {
+	t.Parallel()
+
+	ancestor := &Key{Kind: "Parent", Name: "p"}
+	filter := OrFilter{Filters: []EntityFilter{
+		PropertyFilter{FieldName: "a", Operator: ">=", Value: int64(1)},
+		PropertyFilter{FieldName: "b", Operator: "in", Value: []any{"x", nil}},
+	}}
+	got, err := NewProtoQuery("Kind", ancestor, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	propertyFilter := func(name string, op datastorepb.PropertyFilter_Operator, value *datastorepb.Value) *datastorepb.Filter {
+		return &datastorepb.Filter{FilterType: &datastorepb.Filter_PropertyFilter{PropertyFilter: &datastorepb.PropertyFilter{
+			Property: &datastorepb.PropertyReference{Name: name},
+			Op:       op,
+			Value:    value,
+		}}}
+	}
+	compositeFilter := func(op datastorepb.CompositeFilter_Operator, filters ...*datastorepb.Filter) *datastorepb.Filter {
+		return &datastorepb.Filter{FilterType: &datastorepb.Filter_CompositeFilter{CompositeFilter: &datastorepb.CompositeFilter{
+			Op:      op,
+			Filters: filters,
+		}}}
+	}
+	want := &datastorepb.Query{
+		Kind: []*datastorepb.KindExpression{{Name: "Kind"}},
+		Filter: compositeFilter(datastorepb.CompositeFilter_AND,
+			propertyFilter("__key__", datastorepb.PropertyFilter_HAS_ANCESTOR, &datastorepb.Value{ValueType: &datastorepb.Value_KeyValue{KeyValue: ancestor.ToProto()}}),
+			compositeFilter(datastorepb.CompositeFilter_OR,
+				propertyFilter("a", datastorepb.PropertyFilter_GREATER_THAN_OR_EQUAL, &datastorepb.Value{ValueType: &datastorepb.Value_IntegerValue{IntegerValue: 1}}),
+				propertyFilter("b", datastorepb.PropertyFilter_IN, &datastorepb.Value{ValueType: &datastorepb.Value_ArrayValue{ArrayValue: &datastorepb.ArrayValue{Values: []*datastorepb.Value{
+					{ValueType: &datastorepb.Value_StringValue{StringValue: "x"}},
+					{ValueType: &datastorepb.Value_NullValue{}},
+				}}}}),
+			),
+		),
+	}
+	if diff := cmp.Diff(want, got, protocmp.Transform()); diff != "" {
+		t.Errorf("unexpected query (-want +got):\n%s", diff)
+	}
+
+	if _, err := NewProtoQuery("Kind", nil, PropertyFilter{FieldName: "a", Operator: "~", Value: int64(1)}); err == nil {
+		t.Error("expected an error for an unknown operator")
+	}
+}
+
+func TestFromProtoExplainMetrics(t *testing.T) {
+	t.Parallel()
+
+	indexUsed, err := structpb.NewStruct(map[string]any{"query_scope": "Collection group", "properties": "(a ASC, __name__ ASC)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	debugStats, err := structpb.NewStruct(map[string]any{"documents_scanned": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	planSummary := &datastorepb.PlanSummary{IndexesUsed: []*structpb.Struct{indexUsed}}
+	wantPlanSummary := &PlanSummary{IndexesUsed: []*map[string]any{{"query_scope": "Collection group", "properties": "(a ASC, __name__ ASC)"}}}
+	executionDuration := 1500 * time.Microsecond
+
+	tests := []struct {
+		name string
+		src  *datastorepb.ExplainMetrics
+		want *ExplainMetrics
+	}{
+		{
+			name: "plan",
+			src:  &datastorepb.ExplainMetrics{PlanSummary: planSummary},
+			want: &ExplainMetrics{PlanSummary: wantPlanSummary},
+		},
+		{
+			name: "analyze",
+			src: &datastorepb.ExplainMetrics{PlanSummary: planSummary, ExecutionStats: &datastorepb.ExecutionStats{
+				ResultsReturned:   1,
+				ExecutionDuration: durationpb.New(executionDuration),
+				ReadOperations:    2,
+				DebugStats:        debugStats,
+			}},
+			want: &ExplainMetrics{PlanSummary: wantPlanSummary, ExecutionStats: &ExecutionStats{
+				ResultsReturned:   1,
+				ExecutionDuration: &executionDuration,
+				ReadOperations:    2,
+				DebugStats:        &map[string]any{"documents_scanned": "1"},
+			}},
+		},
+		{
+			name: "nil",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if diff := cmp.Diff(tt.want, fromProtoExplainMetrics(tt.src)); diff != "" {
+				t.Errorf("unexpected metrics (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestGQLBindingsToProto(t *testing.T) {
+	t.Parallel()
+
+	bindings := &GQLBindings{
+		Positional: []Value{{Type: IntType, Value: int64(1)}},
+		Named:      map[string]Value{"owner": {Type: KeyType, Value: &Key{Kind: "User", Name: "alice"}}},
+	}
+	positional, named, err := bindings.toProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPositional := []*datastorepb.GqlQueryParameter{
+		{ParameterType: &datastorepb.GqlQueryParameter_Value{Value: &datastorepb.Value{ValueType: &datastorepb.Value_IntegerValue{IntegerValue: 1}}}},
+	}
+	if diff := cmp.Diff(wantPositional, positional, protocmp.Transform()); diff != "" {
+		t.Errorf("unexpected positional bindings (-want +got):\n%s", diff)
+	}
+	wantNamed := map[string]*datastorepb.GqlQueryParameter{
+		"owner": {ParameterType: &datastorepb.GqlQueryParameter_Value{Value: &datastorepb.Value{ValueType: &datastorepb.Value_KeyValue{KeyValue: (&Key{Kind: "User", Name: "alice"}).ToProto()}}}},
+	}
+	if diff := cmp.Diff(wantNamed, named, protocmp.Transform()); diff != "" {
+		t.Errorf("unexpected named bindings (-want +got):\n%s", diff)
+	}
+
+	var nilBindings *GQLBindings
+	if positional, named, err := nilBindings.toProto(); positional != nil || named != nil || err != nil {
+		t.Errorf("unexpected result for nil bindings: %v %v %v", positional, named, err)
+	}
+}
@@ -0,0 +1,25 @@
+package datastore
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+)
+
+// QueryLimit extracts the limit of the query from the Datastore SDK's private field,
+// which the SDK does not expose. It is negative if the query has no limit.
+// Keep TestQueryLimitSDKCompatibility in sync with cloud.google.com/go/datastore upgrades.
+func QueryLimit(q *Query) int {
+	return int(extractPrivateField[int32](reflect.ValueOf(q).Elem(), "limit"))
+}
+
+// DecodeCursorBytes decodes a cursor from its string representation (see datastore.Cursor.String)
+// to the bytes for the low-level API.
+func DecodeCursorBytes(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// CursorFromBytes creates a cursor from the bytes of the low-level API.
+func CursorFromBytes(b []byte) (Cursor, error) {
+	return DecodeCursor(base64.RawURLEncoding.EncodeToString(b))
+}
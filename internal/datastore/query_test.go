@@ -0,0 +1,14 @@
+package datastore
+
+import "testing"
+
+func TestQueryLimitSDKCompatibility(t *testing.T) {
+	t.Parallel()
+
+	if got := QueryLimit(NewQuery("Foo")); got >= 0 {
+		t.Errorf("QueryLimit() = %d for a query without limit, want negative", got)
+	}
+	if got := QueryLimit(NewQuery("Foo").Limit(10).Offset(5)); got != 10 {
+		t.Errorf("QueryLimit() = %d, want 10", got)
+	}
+}
@@ -16,6 +16,8 @@ type Mutation = datastore.Mutation
 var (
 	NewInsert = datastore.NewInsert
 	NewUpdate = datastore.NewUpdate
+	NewUpsert = datastore.NewUpsert
+	NewDelete = datastore.NewDelete
 )
 
 type MultiError = datastore.MultiError
@@ -24,6 +26,12 @@ var ErrNoSuchEntity = datastore.ErrNoSuchEntity
 
 type Query = datastore.Query
 
+type Iterator = datastore.Iterator
+
+type Cursor = datastore.Cursor
+
+var DecodeCursor = datastore.DecodeCursor
+
 type AggregationQuery = datastore.AggregationQuery
 
 var NewQuery = datastore.NewQuery
@@ -41,6 +49,8 @@ type RunOption = datastore.RunOption
 type (
 	ExplainOptions = datastore.ExplainOptions
 	ExplainMetrics = datastore.ExplainMetrics
+	PlanSummary    = datastore.PlanSummary
+	ExecutionStats = datastore.ExecutionStats
 )
 
 type GeoPoint struct {
@@ -21,17 +21,50 @@ type EmbeddedEntity struct {
 }
 
 func (v *Value) fromDatastoreProtoValue(src *datastorepb.Value) {
-	// NOTE: not fully types supported because actual types are not used (this is just used by the aggregation query)
 	switch value := src.ValueType.(type) {
-	case *datastorepb.Value_IntegerValue:
-		v.Type = IntType
-		v.Value = value.IntegerValue
+	case *datastorepb.Value_ArrayValue:
+		values := value.ArrayValue.GetValues()
+		dest := make([]Value, len(values))
+		for i, v := range values {
+			dest[i].fromDatastoreProtoValue(v)
+		}
+		v.Type = ArrayType
+		v.Value = dest
+	case *datastorepb.Value_BlobValue:
+		v.Type = BlobType
+		v.Value = value.BlobValue
+	case *datastorepb.Value_BooleanValue:
+		v.Type = BoolType
+		v.Value = value.BooleanValue
+	case *datastorepb.Value_TimestampValue:
+		v.Type = TimestampType
+		v.Value = value.TimestampValue.AsTime()
+	case *datastorepb.Value_EntityValue:
+		v.Type = EntityType
+		properties := propertiesFromProto(value.EntityValue.GetProperties())
+		if key := value.EntityValue.GetKey(); key != nil {
+			v.Value = EmbeddedEntity{Key: FromProtoKey(key), Properties: properties}
+		} else {
+			v.Value = properties
+		}
 	case *datastorepb.Value_DoubleValue:
 		v.Type = FloatType
 		v.Value = value.DoubleValue
+	case *datastorepb.Value_GeoPointValue:
+		v.Type = GeoPointType
+		v.Value = GeoPoint{Lat: value.GeoPointValue.GetLatitude(), Lng: value.GeoPointValue.GetLongitude()}
+	case *datastorepb.Value_IntegerValue:
+		v.Type = IntType
+		v.Value = value.IntegerValue
+	case *datastorepb.Value_KeyValue:
+		v.Type = KeyType
+		v.Value = FromProtoKey(value.KeyValue)
 	case *datastorepb.Value_NullValue:
 		v.Type = NullType
 		v.Value = nil
+	case *datastorepb.Value_StringValue:
+		v.Type = StringType
+		v.Value = value.StringValue
 	default:
 		panic(fmt.Sprintf("unexpected value type: %T", src.ValueType))
 	}
@@ -76,13 +109,14 @@ func (v *Value) fromDatastoreValue(src any) {
 	}
 }
 
-func (v *Value) toDatastoreValue() any {
+// ToDatastoreValue converts the value to the representation of cloud.google.com/go/datastore.
+func (v *Value) ToDatastoreValue() any {
 	switch v.Type {
 	case ArrayType:
 		src := v.Value.([]Value)
 		dest := make([]any, len(src))
 		for i, v := range src {
-			dest[i] = v.toDatastoreValue()
+			dest[i] = v.ToDatastoreValue()
 		}
 		return dest
 
@@ -90,7 +90,7 @@ func TestValueEntityRoundTripPreservesKey(t *testing.T) {
 			var value Value
 			value.fromDatastoreValue(src)
 
-			got := value.toDatastoreValue().(*clouddatastore.Entity)
+			got := value.ToDatastoreValue().(*clouddatastore.Entity)
 			if tt.key == nil {
 				if got.Key != nil {
 					t.Fatalf("unexpected key after round trip: %v", got.Key)
@@ -131,7 +131,7 @@ func TestValueEntityJSONCompatibility(t *testing.T) {
 	if err := json.Unmarshal(keyedJSON, &keyed); err != nil {
 		t.Fatalf("failed to unmarshal keyed entity value: %v", err)
 	}
-	entity := keyed.toDatastoreValue().(*clouddatastore.Entity)
+	entity := keyed.ToDatastoreValue().(*clouddatastore.Entity)
 	wantKey := clouddatastore.NameKey("Embedded", "example", nil)
 	if entity.Key == nil || !entity.Key.Equal(wantKey) {
 		t.Fatalf("unexpected embedded entity key: got %v, want %v", entity.Key, wantKey)
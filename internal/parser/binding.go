@@ -0,0 +1,172 @@
+package parser
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+	"github.com/karupanerura/gqlparser"
+)
+
+type BindingParser struct {
+	Namespace string
+}
+
+// ParseBindings parses the bindings of NAME=TYPE:VALUE and NAME=JSON (the JSON representation of values).
+// NAME is a positive integer for the positional binding sites (@1, @2, ...) or a name for the named ones (@name),
+// and the positional ones must be contiguous from 1.
+func (p *BindingParser) ParseBindings(typed, jsons []string) (*datastore.GQLBindings, error) {
+	values := make(map[string]datastore.Value, len(typed)+len(jsons))
+	set := func(name string, value datastore.Value) error {
+		if name == "" {
+			return fmt.Errorf("binding name must not be empty")
+		}
+		if _, ok := values[name]; ok {
+			return fmt.Errorf("duplicate binding: @%s", name)
+		}
+		values[name] = value
+		return nil
+	}
+	for _, s := range typed {
+		name, typedValue, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("binding must be NAME=TYPE:VALUE but got %q", s)
+		}
+		value, err := p.ParseTypedValue(typedValue)
+		if err != nil {
+			return nil, fmt.Errorf("binding @%s: %w", name, err)
+		}
+		if err := set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range jsons {
+		name, valueJSON, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("binding must be NAME=JSON but got %q", s)
+		}
+		var value datastore.Value
+		if err := json.Unmarshal([]byte(valueJSON), &value); err != nil {
+			return nil, fmt.Errorf("binding @%s: %w", name, err)
+		}
+		if err := set(name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	bindings := &datastore.GQLBindings{}
+	indexes := map[int]datastore.Value{}
+	for name, value := range values {
+		if index, err := strconv.Atoi(name); err == nil {
+			if index <= 0 {
+				return nil, fmt.Errorf("positional binding must be positive but got @%s", name)
+			}
+			indexes[index] = value
+			continue
+		}
+		if bindings.Named == nil {
+			bindings.Named = map[string]datastore.Value{}
+		}
+		bindings.Named[name] = value
+	}
+	for i := 1; i <= len(indexes); i++ {
+		value, ok := indexes[i]
+		if !ok {
+			return nil, fmt.Errorf("positional bindings must be contiguous but @%d is missing", i)
+		}
+		bindings.Positional = append(bindings.Positional, value)
+	}
+	return bindings, nil
+}
+
+// ParseTypedValue parses TYPE:VALUE by the types of the JSON representation of values:
+// int, float, bool, string, timestamp (RFC3339), key (key(<kind>, <identifier>) or encoded key),
+// blob (standard base64), geo (<lat>,<lng>) and null (without VALUE). Use the JSON representation for arrays and entities.
+func (p *BindingParser) ParseTypedValue(s string) (datastore.Value, error) {
+	typ, value, _ := strings.Cut(s, ":")
+	switch datastore.Type(typ) {
+	case datastore.IntType:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return datastore.Value{}, err
+		}
+		return datastore.Value{Type: datastore.IntType, Value: v}, nil
+	case datastore.FloatType:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return datastore.Value{}, err
+		}
+		return datastore.Value{Type: datastore.FloatType, Value: v}, nil
+	case datastore.BoolType:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return datastore.Value{}, err
+		}
+		return datastore.Value{Type: datastore.BoolType, Value: v}, nil
+	case datastore.StringType:
+		return datastore.Value{Type: datastore.StringType, Value: value}, nil
+	case datastore.TimestampType:
+		v, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return datastore.Value{}, err
+		}
+		return datastore.Value{Type: datastore.TimestampType, Value: v}, nil
+	case datastore.KeyType:
+		keyParser := &KeyParser{Namespace: p.Namespace}
+		v, err := keyParser.ParseKey(value)
+		if err != nil {
+			return datastore.Value{}, err
+		}
+		return datastore.Value{Type: datastore.KeyType, Value: v}, nil
+	case datastore.BlobType:
+		v, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return datastore.Value{}, err
+		}
+		return datastore.Value{Type: datastore.BlobType, Value: v}, nil
+	case datastore.GeoPointType:
+		lat, lng, ok := strings.Cut(value, ",")
+		if !ok {
+			return datastore.Value{}, fmt.Errorf("geo must be <lat>,<lng> but got %q", value)
+		}
+		var v datastore.GeoPoint
+		var err error
+		if v.Lat, err = strconv.ParseFloat(strings.TrimSpace(lat), 64); err != nil {
+			return datastore.Value{}, err
+		}
+		if v.Lng, err = strconv.ParseFloat(strings.TrimSpace(lng), 64); err != nil {
+			return datastore.Value{}, err
+		}
+		return datastore.Value{Type: datastore.GeoPointType, Value: v}, nil
+	case datastore.NullType:
+		if value != "" {
+			return datastore.Value{}, fmt.Errorf("null must not have a value but got %q", value)
+		}
+		return datastore.Value{Type: datastore.NullType}, nil
+	default:
+		return datastore.Value{}, fmt.Errorf("unknown type: %s", typ)
+	}
+}
+
+// newBindingResolver creates the resolver of the binding sites with the values of cloud.google.com/go/datastore.
+// The bindings may be nil, and then any binding site is an error.
+func newBindingResolver(bindings *datastore.GQLBindings) *gqlparser.BindingResolver {
+	resolver := &gqlparser.BindingResolver{}
+	if bindings == nil {
+		return resolver
+	}
+	for _, v := range bindings.Positional {
+		resolver.Indexed = append(resolver.Indexed, v.ToDatastoreValue())
+	}
+	if len(bindings.Named) != 0 {
+		resolver.Named = make(map[string]any, len(bindings.Named))
+		for name, v := range bindings.Named {
+			resolver.Named[name] = v.ToDatastoreValue()
+		}
+	}
+	return resolver
+}
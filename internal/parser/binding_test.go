@@ -0,0 +1,187 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	clouddatastore "cloud.google.com/go/datastore"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	internaldatastore "github.com/karupanerura/dutil/internal/datastore"
+)
+
+func TestBindingParserParseTypedValue(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		src     string
+		want    internaldatastore.Value
+		wantErr bool
+	}{
+		{src: "int:42", want: internaldatastore.Value{Type: internaldatastore.IntType, Value: int64(42)}},
+		{src: "float:1.5", want: internaldatastore.Value{Type: internaldatastore.FloatType, Value: 1.5}},
+		{src: "bool:true", want: internaldatastore.Value{Type: internaldatastore.BoolType, Value: true}},
+		{src: `string:it's "quoted"`, want: internaldatastore.Value{Type: internaldatastore.StringType, Value: `it's "quoted"`}},
+		{src: "string:", want: internaldatastore.Value{Type: internaldatastore.StringType, Value: ""}},
+		{src: "timestamp:2024-01-02T03:04:05Z", want: internaldatastore.Value{Type: internaldatastore.TimestampType, Value: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}},
+		{src: `key:KEY(User, "alice")`, want: internaldatastore.Value{Type: internaldatastore.KeyType, Value: &internaldatastore.Key{Kind: "User", Name: "alice", Namespace: "ns"}}},
+		{src: "blob:Zm9v", want: internaldatastore.Value{Type: internaldatastore.BlobType, Value: []byte("foo")}},
+		{src: "geo:35.1, 139.2", want: internaldatastore.Value{Type: internaldatastore.GeoPointType, Value: internaldatastore.GeoPoint{Lat: 35.1, Lng: 139.2}}},
+		{src: "null", want: internaldatastore.Value{Type: internaldatastore.NullType}},
+		{src: "null:x", wantErr: true},
+		{src: "int:x", wantErr: true},
+		{src: "geo:1", wantErr: true},
+		{src: "array:[]", wantErr: true},
+		{src: "42", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			t.Parallel()
+
+			p := &BindingParser{Namespace: "ns"}
+			got, err := p.ParseTypedValue(tt.src)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error but got %+v", got)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected value (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBindingParserParseBindings(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		typed   []string
+		jsons   []string
+		want    *internaldatastore.GQLBindings
+		wantErr bool
+	}{
+		{
+			name:  "positional and named",
+			typed: []string{"2=string:b", "1=int:1", "name=string:x=y"},
+			jsons: []string{`tags={"type":"array","value":[{"type":"string","value":"a"}]}`},
+			want: &internaldatastore.GQLBindings{
+				Positional: []internaldatastore.Value{
+					{Type: internaldatastore.IntType, Value: int64(1)},
+					{Type: internaldatastore.StringType, Value: "b"},
+				},
+				Named: map[string]internaldatastore.Value{
+					"name": {Type: internaldatastore.StringType, Value: "x=y"},
+					"tags": {Type: internaldatastore.ArrayType, Value: []internaldatastore.Value{{Type: internaldatastore.StringType, Value: "a"}}},
+				},
+			},
+		},
+		{name: "empty", want: &internaldatastore.GQLBindings{}},
+		{name: "not contiguous", typed: []string{"1=int:1", "3=int:3"}, wantErr: true},
+		{name: "not positive", typed: []string{"0=int:0"}, wantErr: true},
+		{name: "duplicate", typed: []string{"a=int:1"}, jsons: []string{`a={"type":"int","value":1}`}, wantErr: true},
+		{name: "without name", typed: []string{"int:1"}, wantErr: true},
+		{name: "empty name", typed: []string{"=int:1"}, wantErr: true},
+		{name: "invalid JSON", jsons: []string{"a=1"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			p := &BindingParser{}
+			got, err := p.ParseBindings(tt.typed, tt.jsons)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error but got %+v", got)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected bindings (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestQueryParserParseGQL_Bindings(t *testing.T) {
+	t.Parallel()
+
+	bindings := &internaldatastore.GQLBindings{
+		Positional: []internaldatastore.Value{{Type: internaldatastore.StringType, Value: `" OR b = 1`}},
+		Named: map[string]internaldatastore.Value{
+			"owner":  {Type: internaldatastore.KeyType, Value: &internaldatastore.Key{Kind: "User", Name: "alice"}},
+			"parent": {Type: internaldatastore.KeyType, Value: &internaldatastore.Key{Kind: "Group", ID: 1}},
+		},
+	}
+	qp := &QueryParser{Bindings: bindings}
+	q, _, _, err := qp.ParseGQL("SELECT * FROM Task WHERE name = @1 AND owner = @owner AND __key__ HAS ANCESTOR @parent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := internaldatastore.NewQuery("Task").
+		Ancestor(&clouddatastore.Key{Kind: "Group", ID: 1}).
+		FilterEntity(internaldatastore.AndFilter{Filters: []internaldatastore.EntityFilter{
+			internaldatastore.PropertyFilter{FieldName: "name", Operator: "=", Value: `" OR b = 1`},
+			internaldatastore.PropertyFilter{FieldName: "owner", Operator: "=", Value: &clouddatastore.Key{Kind: "User", Name: "alice"}},
+		}})
+	if diff := cmp.Diff(want, q, cmp.AllowUnexported(clouddatastore.Query{}), cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("unexpected query (-want +got):\n%s", diff)
+	}
+
+	if _, _, _, err := (&QueryParser{}).ParseGQL("SELECT * FROM Task WHERE name = @name"); err == nil {
+		t.Error("expected an error for the unbound binding site")
+	}
+}
+
+func TestQueryParserParseGQL_CursorBindings(t *testing.T) {
+	t.Parallel()
+
+	const encoded = "Y3Vyc29y"
+	bindings := &internaldatastore.GQLBindings{Named: map[string]internaldatastore.Value{
+		"start": {Type: internaldatastore.StringType, Value: encoded},
+		"end":   {Type: internaldatastore.StringType, Value: encoded},
+	}}
+	qp := &QueryParser{Bindings: bindings}
+	q, _, _, err := qp.ParseGQL("SELECT * FROM Task LIMIT FIRST(@end, 10) OFFSET @start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := internaldatastore.DecodeCursor(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := internaldatastore.NewQuery("Task").Limit(10).End(cursor).Start(cursor)
+	if diff := cmp.Diff(want, q, cmp.AllowUnexported(clouddatastore.Query{}), cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("unexpected query (-want +got):\n%s", diff)
+	}
+
+	qp.Bindings = &internaldatastore.GQLBindings{Positional: []internaldatastore.Value{{Type: internaldatastore.IntType, Value: int64(1)}}}
+	if _, _, _, err := qp.ParseGQL("SELECT * FROM Task OFFSET @1"); err == nil {
+		t.Error("expected an error for the non-string cursor")
+	}
+}
+
+func TestFilterParserParseFilterKeyBindings(t *testing.T) {
+	t.Parallel()
+
+	bindings := &internaldatastore.GQLBindings{Named: map[string]internaldatastore.Value{
+		"keys": {Type: internaldatastore.ArrayType, Value: []internaldatastore.Value{
+			{Type: internaldatastore.KeyType, Value: &internaldatastore.Key{Kind: "Task", ID: 1}},
+		}},
+	}}
+	fp := &FilterParser{Bindings: bindings}
+	_, filter, err := fp.ParseFilter("__key__ IN @keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := internaldatastore.PropertyFilter{FieldName: "__key__", Operator: "in", Value: []any{&clouddatastore.Key{Kind: "Task", ID: 1}}}
+	if diff := cmp.Diff(want, filter); diff != "" {
+		t.Errorf("unexpected filter (-want +got):\n%s", diff)
+	}
+}
@@ -3,12 +3,17 @@ package parser
 import (
 	"fmt"
 
+	clouddatastore "cloud.google.com/go/datastore"
+
 	"github.com/karupanerura/dutil/internal/datastore"
 	"github.com/karupanerura/gqlparser"
 )
 
 type FilterParser struct {
 	Namespace string
+
+	// Bindings are the values of the binding sites (@1 and @name) in the condition
+	Bindings *datastore.GQLBindings
 }
 
 // ParseFilter parses GQL compound-condition
@@ -18,7 +23,16 @@ func (p *FilterParser) ParseFilter(s string) (*datastore.Key, datastore.EntityFi
 		return nil, nil, fmt.Errorf("gqlparser.ParseCondition: %w", err)
 	}
 
-	return p.convertCondition(parsed.Normalize())
+	return p.bindAndConvertCondition(parsed)
+}
+
+// bindAndConvertCondition resolves the binding sites in the condition by the values, and converts it.
+// The values are never parsed as GQL, so they are safe from injections.
+func (p *FilterParser) bindAndConvertCondition(c gqlparser.Condition) (*datastore.Key, datastore.EntityFilter, error) {
+	if err := c.Bind(newBindingResolver(p.Bindings)); err != nil {
+		return nil, nil, fmt.Errorf("condition.Bind: %w", err)
+	}
+	return p.convertCondition(c.Normalize())
 }
 
 func (p *FilterParser) convertCondition(c gqlparser.Condition) (*datastore.Key, datastore.EntityFilter, error) {
@@ -71,11 +85,11 @@ func (p *FilterParser) convertCondition(c gqlparser.Condition) (*datastore.Key,
 			if c.Property.String() != "__key__" {
 				return nil, nil, fmt.Errorf("HAS ANCESTOR is only valid for __key__")
 			}
-			key, ok := c.Value.(*gqlparser.Key)
+			key, ok := p.convertKeyValue(c.Value)
 			if !ok {
 				return nil, nil, fmt.Errorf("HAS ANCESTOR value must be a key")
 			}
-			return p.convertKey(key), nil, nil
+			return key, nil, nil
 		}
 		value := c.Value
 		if c.Property.String() == "__key__" {
@@ -85,11 +99,11 @@ func (p *FilterParser) convertCondition(c gqlparser.Condition) (*datastore.Key,
 			}
 			keys := make([]any, len(values))
 			for i, v := range values {
-				key, ok := v.(*gqlparser.Key)
+				key, ok := p.convertKeyValue(v)
 				if !ok {
 					return nil, datastore.PropertyFilter{}, fmt.Errorf("__key__ comparator value must be a key")
 				}
-				keys[i] = p.convertKey(key).ToDatastore()
+				keys[i] = key.ToDatastore()
 			}
 			value = keys
 		}
@@ -108,11 +122,11 @@ func (p *FilterParser) convertCondition(c gqlparser.Condition) (*datastore.Key,
 			if c.Property.String() == "__key__" {
 				keys := make([]any, len(values))
 				for i, v := range values {
-					key, ok := v.(*gqlparser.Key)
+					key, ok := p.convertKeyValue(v)
 					if !ok {
 						return nil, datastore.PropertyFilter{}, fmt.Errorf("__key__ comparator value must be a key")
 					}
-					keys[i] = p.convertKey(key).ToDatastore()
+					keys[i] = key.ToDatastore()
 				}
 				values = keys
 			}
@@ -136,12 +150,12 @@ func (p *FilterParser) convertCondition(c gqlparser.Condition) (*datastore.Key,
 
 		value := c.Value
 		if c.Property.String() == "__key__" {
-			key, ok := c.Value.(*gqlparser.Key)
+			key, ok := p.convertKeyValue(c.Value)
 			if !ok {
 				return nil, datastore.PropertyFilter{}, fmt.Errorf("__key__ comparator value must be a key")
 			}
 
-			value = p.convertKey(key).ToDatastore()
+			value = key.ToDatastore()
 		}
 		if value == nil {
 			// workaround: IS NULL filter will be rejected
@@ -197,6 +211,18 @@ func convertForwardComparator(c gqlparser.ForwardComparator) (string, error) {
 	}
 }
 
+// convertKeyValue converts a key literal or a bound key.
+func (p *FilterParser) convertKeyValue(v any) (*datastore.Key, bool) {
+	switch v := v.(type) {
+	case *gqlparser.Key:
+		return p.convertKey(v), true
+	case *clouddatastore.Key:
+		return datastore.FromDatastoreKey(v), true
+	default:
+		return nil, false
+	}
+}
+
 func (p *FilterParser) convertKey(src *gqlparser.Key) *datastore.Key {
 	namespace := string(src.Namespace)
 	if namespace == "" {
@@ -1,14 +1,22 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/karupanerura/dutil/internal/datastore"
 	"github.com/karupanerura/gqlparser"
 )
 
+// ErrCountUpToAggregation is returned by ParseGQL for COUNT_UP_TO aggregation queries,
+// which cloud.google.com/go/datastore does not support. Run them with the low-level client instead.
+var ErrCountUpToAggregation = errors.New("COUNT_UP_TO aggregation is not supported by cloud.google.com/go/datastore")
+
 type QueryParser struct {
 	Namespace string
+
+	// Bindings are the values of the binding sites (@1 and @name) in the query
+	Bindings *datastore.GQLBindings
 }
 
 func (p *QueryParser) ParseGQL(query string) (*datastore.Query, bool, *datastore.AggregationQuery, error) {
@@ -48,8 +56,8 @@ func (p *QueryParser) ParseGQL(query string) (*datastore.Query, bool, *datastore
 		}
 	}
 	if q.Where != nil {
-		filterParser := &FilterParser{Namespace: p.Namespace}
-		ancestor, filter, err := filterParser.convertCondition(q.Where.Normalize())
+		filterParser := &FilterParser{Namespace: p.Namespace, Bindings: p.Bindings}
+		ancestor, filter, err := filterParser.bindAndConvertCondition(q.Where)
 		if err != nil {
 			return nil, false, nil, fmt.Errorf("filterParser.ParseFilter: %w", err)
 		}
@@ -69,18 +77,36 @@ func (p *QueryParser) ParseGQL(query string) (*datastore.Query, bool, *datastore
 	}
 	if q.Limit != nil {
 		dq = dq.Limit(int(q.Limit.Position))
+		if q.Limit.Cursor != nil {
+			cursor, err := p.resolveCursor(q.Limit.Cursor)
+			if err != nil {
+				return nil, false, nil, err
+			}
+			dq = dq.End(cursor)
+		}
 	}
 	if q.Offset != nil {
 		dq = dq.Offset(int(q.Offset.Position))
+		if q.Offset.Cursor != nil {
+			cursor, err := p.resolveCursor(q.Offset.Cursor)
+			if err != nil {
+				return nil, false, nil, err
+			}
+			dq = dq.Start(cursor)
+		}
 	}
 	if aq != nil {
+		if err := checkAggregationAliases(aq.Aggregations); err != nil {
+			return nil, false, nil, err
+		}
+
 		daq := dq.NewAggregationQuery()
 		for _, agg := range aq.Aggregations {
 			switch agg := agg.(type) {
 			case *gqlparser.CountAggregation:
 				daq = daq.WithCount(agg.Alias)
 			case *gqlparser.CountUpToAggregation:
-				return nil, false, nil, fmt.Errorf("COUNT_UP_TO aggregation is not yet supported by cloud.google.com/go/datastore")
+				return nil, false, nil, ErrCountUpToAggregation
 			case *gqlparser.SumAggregation:
 				daq = daq.WithSum(agg.Property.String(), agg.Alias)
 			case *gqlparser.AvgAggregation:
@@ -93,3 +119,47 @@ func (p *QueryParser) ParseGQL(query string) (*datastore.Query, bool, *datastore
 	}
 	return dq, keysOnly, nil, nil
 }
+
+// resolveCursor resolves the binding site of LIMIT or OFFSET clause by the string value of the cursor.
+func (p *QueryParser) resolveCursor(bv gqlparser.BindingVariable) (datastore.Cursor, error) {
+	v, err := newBindingResolver(p.Bindings).Resolve(bv)
+	if err != nil {
+		return datastore.Cursor{}, fmt.Errorf("resolve cursor: %w", err)
+	}
+	s, ok := v.(string)
+	if !ok {
+		return datastore.Cursor{}, fmt.Errorf("cursor binding must be a string but got %T", v)
+	}
+	cursor, err := datastore.DecodeCursor(s)
+	if err != nil {
+		return datastore.Cursor{}, fmt.Errorf("invalid cursor: %w", err)
+	}
+	return cursor, nil
+}
+
+// checkAggregationAliases fails if some aggregations have the same alias.
+// Datastore names the aggregations without alias, so they never collide.
+func checkAggregationAliases(aggregations []gqlparser.Aggregation) error {
+	aliases := make(map[string]struct{}, len(aggregations))
+	for _, agg := range aggregations {
+		var alias string
+		switch agg := agg.(type) {
+		case *gqlparser.CountAggregation:
+			alias = agg.Alias
+		case *gqlparser.CountUpToAggregation:
+			alias = agg.Alias
+		case *gqlparser.SumAggregation:
+			alias = agg.Alias
+		case *gqlparser.AvgAggregation:
+			alias = agg.Alias
+		}
+		if alias == "" {
+			continue
+		}
+		if _, ok := aliases[alias]; ok {
+			return fmt.Errorf("duplicate aggregation alias: %s", alias)
+		}
+		aliases[alias] = struct{}{}
+	}
+	return nil
+}
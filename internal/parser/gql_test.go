@@ -0,0 +1,33 @@
+package parser
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQueryParserParseGQL_CountUpTo(t *testing.T) {
+	t.Parallel()
+
+	qp := &QueryParser{}
+	if _, _, _, err := qp.ParseGQL("SELECT COUNT_UP_TO(1000) FROM Kind"); !errors.Is(err, ErrCountUpToAggregation) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, _, aq, err := qp.ParseGQL("SELECT COUNT(*) FROM Kind"); err != nil || aq == nil {
+		t.Errorf("unexpected result: aq=%v err=%v", aq, err)
+	}
+}
+
+func TestQueryParserParseGQL_DuplicateAlias(t *testing.T) {
+	t.Parallel()
+
+	qp := &QueryParser{}
+	if _, _, _, err := qp.ParseGQL("SELECT COUNT(*) AS a, SUM(x) AS a FROM Kind"); err == nil {
+		t.Error("expected an error for duplicate aliases")
+	}
+	if _, _, _, err := qp.ParseGQL("SELECT COUNT_UP_TO(10) AS a, AVG(x) AS a FROM Kind"); err == nil || errors.Is(err, ErrCountUpToAggregation) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, _, aq, err := qp.ParseGQL("SELECT COUNT(*), SUM(x), SUM(y) AS b, AVG(x) AS c FROM Kind"); err != nil || aq == nil {
+		t.Errorf("unexpected result: aq=%v err=%v", aq, err)
+	}
+}
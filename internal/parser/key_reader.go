@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+// KeyReader reads keys one by one. It returns io.EOF at the end of the input.
+type KeyReader interface {
+	Read() (*datastore.Key, error)
+}
+
+// NewKeyReader creates a KeyReader for the format (json, gql, encoded, proto or auto).
+// The json format also accepts entities, and their keys are read.
+// The auto format detects the format from the head of the input.
+func NewKeyReader(format string, reader io.Reader, keyParser *KeyParser) (KeyReader, error) {
+	switch format {
+	case "json":
+		return &jsonKeyReader{decoder: json.NewDecoder(reader)}, nil
+	case "gql":
+		return &gqlKeyReader{reader: bufio.NewReader(reader), keyParser: keyParser}, nil
+	case "encoded":
+		return &encodedKeyReader{reader: bufio.NewReader(reader)}, nil
+	case "proto":
+		return &protoKeyReader{reader: bufio.NewReader(reader)}, nil
+	case "auto":
+		format, reader, err := detectFormat(reader)
+		if err != nil {
+			return nil, fmt.Errorf("detect key format: %w", err)
+		}
+		return NewKeyReader(format, reader, keyParser)
+	default:
+		panic("unknown format:" + format)
+	}
+}
+
+func detectFormat(reader io.Reader) (string, io.Reader, error) {
+	var buffer [4]byte
+	if _, err := io.ReadFull(reader, buffer[:]); err != nil {
+		return "", nil, err
+	}
+
+	header := string(buffer[:])
+	if header[0] == '{' || header == "null" {
+		return "json", io.MultiReader(strings.NewReader(header), reader), nil
+	}
+	if header[3] == '(' {
+		return "gql", io.MultiReader(strings.NewReader(header), reader), nil
+	}
+	if header[0] == 'p' && header[1] == 'a' && ((header[2] == 'r' && header[3] == 't') || (header[2] == 't' && header[3] == 'h')) {
+		return "proto", io.MultiReader(strings.NewReader(header), reader), nil
+	}
+	return "encoded", io.MultiReader(strings.NewReader(header), reader), nil
+}
+
+type jsonKeyReader struct {
+	decoder *json.Decoder
+	line    int
+}
+
+// Read reads a key, or a key of an entity. Nulls (e.g. missing entities of lookup results) are skipped,
+// but keyless entities (e.g. the records of convert aggregate) are errors.
+func (r *jsonKeyReader) Read() (*datastore.Key, error) {
+	for {
+		var raw json.RawMessage
+		if err := r.decoder.Decode(&raw); err != nil {
+			return nil, err
+		}
+		r.line++
+		if bytes.Equal(raw, []byte("null")) {
+			continue
+		}
+
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		keyJSON, isEntity := fields["key"]
+		if !isEntity {
+			_, isEntity = fields["properties"]
+			keyJSON = raw
+		}
+
+		var key *datastore.Key
+		if err := json.Unmarshal(keyJSON, &key); err != nil {
+			return nil, fmt.Errorf("line %d: %w", r.line, err)
+		}
+		if key == nil || key.Kind == "" {
+			if isEntity {
+				return nil, fmt.Errorf("line %d: entity without key", r.line)
+			}
+			return nil, fmt.Errorf("line %d: neither a key nor an entity", r.line)
+		}
+		return key, nil
+	}
+}
+
+type gqlKeyReader struct {
+	reader    *bufio.Reader
+	keyParser *KeyParser
+}
+
+func (r *gqlKeyReader) Read() (*datastore.Key, error) {
+	line, _, err := r.reader.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	return r.keyParser.ParseKey(string(line))
+}
+
+type encodedKeyReader struct {
+	reader *bufio.Reader
+}
+
+func (r *encodedKeyReader) Read() (*datastore.Key, error) {
+	line, _, err := r.reader.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	return datastore.DecodeKey(string(line))
+}
+
+type protoKeyReader struct {
+	reader *bufio.Reader
+}
+
+func (r *protoKeyReader) Read() (*datastore.Key, error) {
+	line, _, err := r.reader.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	return datastore.ParseEncodedProtoKey(string(line))
+}
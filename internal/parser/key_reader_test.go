@@ -0,0 +1,124 @@
+package parser
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/karupanerura/dutil/internal/datastore"
+)
+
+func TestNewKeyReader_Auto(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		input string
+		want  []*datastore.Key
+	}{
+		{
+			name: "keys",
+			input: strings.Join([]string{
+				`{"kind":"Foo","name":"foo"}`,
+				`{"kind":"Bar","id":1,"parent":{"kind":"Foo","name":"foo"}}`,
+			}, "\n"),
+			want: []*datastore.Key{
+				{Kind: "Foo", Name: "foo"},
+				{Kind: "Bar", ID: 1, Parent: &datastore.Key{Kind: "Foo", Name: "foo"}},
+			},
+		},
+		{
+			name: "entities",
+			input: strings.Join([]string{
+				`{"key":{"kind":"Foo","name":"foo"},"properties":[{"name":"p","type":"int","value":1}]}`,
+				`{"key":{"kind":"Foo","name":"bar"}}`,
+			}, "\n"),
+			want: []*datastore.Key{
+				{Kind: "Foo", Name: "foo"},
+				{Kind: "Foo", Name: "bar"},
+			},
+		},
+		{
+			name: "lookup results with missing entities",
+			input: strings.Join([]string{
+				`null`,
+				`{"key":{"kind":"Foo","name":"foo"}}`,
+				`null`,
+			}, "\n"),
+			want: []*datastore.Key{
+				{Kind: "Foo", Name: "foo"},
+			},
+		},
+		{
+			name: "gql keys with spaces",
+			input: strings.Join([]string{
+				`KEY(Foo, "foo bar")`,
+				`KEY(Foo, 1)`,
+			}, "\n"),
+			want: []*datastore.Key{
+				{Kind: "Foo", Name: "foo bar", Namespace: "ns"},
+				{Kind: "Foo", ID: 1, Namespace: "ns"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			reader, err := NewKeyReader("auto", strings.NewReader(tt.input), &KeyParser{Namespace: "ns"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []*datastore.Key
+			for {
+				key, err := reader.Read()
+				if errors.Is(err, io.EOF) {
+					break
+				} else if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, key)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("unexpected keys (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewKeyReader_KeylessRecords(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "null key", input: `{"key":{"kind":"Foo","name":"foo"}}` + "\n" + `{"key":null,"properties":[{"name":"count","type":"int","value":1}]}`},
+		{name: "entity without key", input: `{"properties":[{"name":"count","type":"int","value":1}]}`},
+		{name: "not a key", input: `{"count":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			reader, err := NewKeyReader("json", strings.NewReader(tt.input), &KeyParser{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for {
+				_, err := reader.Read()
+				if errors.Is(err, io.EOF) {
+					t.Fatal("expected an error for the keyless record")
+				} else if err != nil {
+					if !strings.HasPrefix(err.Error(), "line ") {
+						t.Errorf("error does not name the line: %v", err)
+					}
+					return
+				}
+			}
+		})
+	}
+}